@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
 	. "github.com/onsi/ginkgo"
@@ -16,7 +18,28 @@ import (
 //go:noinline
 func test_struct_argument(r *http.Request) { _ = fmt.Sprint(r) }
 
+type test_node struct {
+	val  int
+	next *test_node
+}
+
+//go:noinline
+func test_recursive_argument(n *test_node) int { return n.val }
+
+type test_tree struct {
+	children []test_tree
+	byName   map[string]test_tree
+	visit    func(test_tree)
+	done     chan test_tree
+}
+
+//go:noinline
+func test_recursive_references(t test_tree) int { return len(t.children) }
+
 var _ = Describe("Test Make Type", func() {
+	test_recursive_argument(&test_node{})
+	test_recursive_references(test_tree{})
+
 	test_struct_argument(&http.Request{})
 
 	find := func(trees map[string]*godwarf.Tree, s string) *godwarf.Tree {
@@ -42,13 +65,49 @@ var _ = Describe("Test Make Type", func() {
 		})
 
 		It("tests struct argument function", func() {
-			Skip("Recursive Struct")
-
 			node := find(trees, "test_struct_argument")
 			Expect(node).NotTo(BeNil())
 
 			_, err := MakeFunc(node, dw)
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+
+		It("tests recursive struct argument function", func() {
+			node := find(trees, "test_recursive_argument")
+			Expect(node).NotTo(BeNil())
+
+			ft, err := MakeFunc(node, dw)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ft.In(0).Elem().Size()).To(Equal(reflect.TypeOf(test_node{}).Size()))
+			Expect(ft.In(0).Elem().Field(1).Type).To(Equal(unsafePointerType))
+		})
+
+		It("tests recursion through slices, maps, funcs and chans", func() {
+			node := find(trees, "test_recursive_references")
+			Expect(node).NotTo(BeNil())
+
+			ft, err := MakeFunc(node, dw)
+			Expect(err).ShouldNot(HaveOccurred())
+			st := ft.In(0)
+			Expect(st.Size()).To(Equal(reflect.TypeOf(test_tree{}).Size()))
+			Expect(st.Field(0).Type).To(Equal(sliceHeaderType))
+			for i := 1; i < st.NumField(); i++ {
+				Expect(st.Field(i).Type).To(Equal(unsafePointerType))
+			}
+		})
+
+		It("hijacks a function taking *http.Request", func() {
+			r, _ := New(pid)
+			g, err := (&patcher{}).Delay(r, map[string]interface{}{
+				"func": "github.com/u2386/go-hijack/runtime.test_struct_argument",
+				"val":  100,
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			defer g.Unpatch()
+
+			t0 := time.Now()
+			test_struct_argument(&http.Request{})
+			Expect(time.Since(t0)).To(BeNumerically(">=", 100*time.Millisecond))
+		})
 	})
 })
@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"debug/elf"
+	"fmt"
+	"reflect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:noinline
+func test_for_callbacks(pair func() (int, int), maker func() func() int, in <-chan int, out chan<- int) int {
+	a, b := pair()
+	out <- a + b + maker()() + <-in
+	return a + b
+}
+
+var _ = func() int {
+	in := make(chan int, 1)
+	in <- 0
+	return test_for_callbacks(
+		func() (int, int) { return 0, 0 },
+		func() func() int { return func() int { return 0 } },
+		in, make(chan int, 1),
+	)
+}()
+
+var _ = Describe("Test Callbacks and Channels", func() {
+	const name = "github.com/u2386/go-hijack/runtime.test_for_callbacks"
+
+	It("should count results of func type names", func() {
+		for typ, n := range map[string]int{
+			"func()":                             0,
+			"func(int)":                          0,
+			"func() int":                         1,
+			"func() (int, int)":                  2,
+			"func(func() (int, int)) int":        1,
+			"func() func() (int, error)":         1,
+			"func() (func(int, int), error)":     2,
+			"func(map[string]int) (a, b int)":    2,
+			"func() (struct { a, b int }, bool)": 2,
+			"int":                                0,
+		} {
+			Expect(funcResults(typ)).To(Equal(n), typ)
+		}
+	})
+
+	It("should read channel directions", func() {
+		Expect(chanDir("chan int")).To(Equal(reflect.BothDir))
+		Expect(chanDir("<-chan int")).To(Equal(reflect.RecvDir))
+		Expect(chanDir("chan<- int")).To(Equal(reflect.SendDir))
+		Expect(chanDir("chan <-chan int")).To(Equal(reflect.BothDir))
+	})
+
+	It("should reconstruct callbacks and channels without runtime types", func() {
+		ef, _ := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+		dw, _ := ef.DWARF()
+		trees, _ := DwarfTree(dw)
+
+		ft, err := MakeFunc(trees[name], dw)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft).To(Equal(reflect.TypeOf(test_for_callbacks)))
+	})
+
+	It("should pass callbacks through hijacked functions", func() {
+		r, _ := New(pid)
+		g, err := (&patcher{}).Delay(r, map[string]interface{}{"func": name, "val": 1})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		in, out := make(chan int, 1), make(chan int, 1)
+		in <- 100
+		v := test_for_callbacks(
+			func() (int, int) { return 1, 2 },
+			func() func() int { return func() int { return 10 } },
+			in, out,
+		)
+		Expect(v).To(Equal(3))
+		Expect(<-out).To(Equal(113))
+	})
+})
@@ -0,0 +1,166 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	FuncQuery struct {
+		Package   string
+		Regexp    string
+		Exported  bool
+		HasDwarf  bool `mapstructure:"has_dwarf"`
+		Patchable bool
+		Sort      string
+		Offset    int
+		Limit     int
+	}
+
+	FuncInfo struct {
+		Name      string `json:"name"`
+		Package   string `json:"package"`
+		Signature string `json:"signature,omitempty"`
+		File      string `json:"file,omitempty"`
+		Line      int    `json:"line,omitempty"`
+		Size      uint64 `json:"size"`
+		Dwarf     bool   `json:"dwarf"`
+		Patchable bool   `json:"patchable"`
+		Hijacked  bool   `json:"hijacked"`
+	}
+
+	FuncCatalog struct {
+		Total  int        `json:"total"`
+		Offset int        `json:"offset"`
+		Funcs  []FuncInfo `json:"funcs"`
+	}
+)
+
+const (
+	SortByName    = "name"
+	SortBySize    = "size"
+	SortByPackage = "package"
+)
+
+// FuncPackage returns the import path part of a symbol name such as
+// `net/http.(*Request).Context`.
+func FuncPackage(name string) string {
+	i := strings.LastIndex(name, "/")
+	j := strings.Index(name[i+1:], ".")
+	if j < 0 {
+		return ""
+	}
+	return name[:i+1+j]
+}
+
+func isExported(name string) bool {
+	return token.IsExported(name[strings.LastIndex(name, ".")+1:])
+}
+
+func isFunc(sym elf.Symbol) bool {
+	return elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Section != elf.SHN_UNDEF
+}
+
+func (r *Runtime) declFile(off dwarf.Offset) string {
+	r.declOnce.Do(func() {
+		fs, err := DeclFiles(r.dwarf)
+		if err != nil {
+			debug("read decl files:%s", err)
+		}
+		r.declFiles = fs
+	})
+	return r.declFiles[off]
+}
+
+func (r *Runtime) funcInfo(name string, sym elf.Symbol) FuncInfo {
+	info := FuncInfo{
+		Name:    name,
+		Package: FuncPackage(name),
+		Size:    sym.Size,
+	}
+	if _, ok := r.M.Load(name); ok {
+		info.Hijacked = true
+	}
+
+	node, ok := r.dwarftrees[name]
+	if !ok {
+		return info
+	}
+	info.Dwarf = true
+	info.File = r.declFile(node.Offset)
+	if line, ok := node.Entry.Val(dwarf.AttrDeclLine).(int64); ok {
+		info.Line = int(line)
+	}
+	if sig, err := r.types.FuncSignature(node); err == nil {
+		info.Signature = sig
+	}
+	info.Patchable = r.Check(name).Patchable
+	return info
+}
+
+func (r *Runtime) Catalog(q FuncQuery) (*FuncCatalog, error) {
+	var re *regexp.Regexp
+	if q.Regexp != "" {
+		var err error
+		if re, err = regexp.Compile(q.Regexp); err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	for name, sym := range r.symbols {
+		if !isFunc(sym) {
+			continue
+		}
+		if q.Package != "" && FuncPackage(name) != q.Package {
+			continue
+		}
+		if re != nil && !re.MatchString(name) {
+			continue
+		}
+		if q.Exported && !isExported(name) {
+			continue
+		}
+		if _, ok := r.dwarftrees[name]; q.HasDwarf && !ok {
+			continue
+		}
+		if q.Patchable && !r.Check(name).Patchable {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	switch q.Sort {
+	case "", SortByName:
+	case SortBySize:
+		sort.SliceStable(names, func(i, j int) bool {
+			return r.symbols[names[i]].Size > r.symbols[names[j]].Size
+		})
+	case SortByPackage:
+		sort.SliceStable(names, func(i, j int) bool {
+			return FuncPackage(names[i]) < FuncPackage(names[j])
+		})
+	default:
+		return nil, ErrUnsupportedSort
+	}
+
+	c := &FuncCatalog{Total: len(names), Offset: q.Offset}
+	if q.Offset < 0 || q.Offset >= len(names) {
+		return c, nil
+	}
+	names = names[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(names) {
+		names = names[:q.Limit]
+	}
+
+	c.Funcs = make([]FuncInfo, 0, len(names))
+	for _, name := range names {
+		c.Funcs = append(c.Funcs, r.funcInfo(name, r.symbols[name]))
+	}
+	return c, nil
+}
@@ -0,0 +1,77 @@
+package runtime
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Function Catalog", func() {
+	var (
+		r *Runtime
+	)
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	It("should split package from symbol name", func() {
+		Expect(FuncPackage("github.com/u2386/go-hijack/runtime.this_is_for_test")).To(Equal("github.com/u2386/go-hijack/runtime"))
+		Expect(FuncPackage("net/http.(*Request).Context")).To(Equal("net/http"))
+		Expect(FuncPackage("main.main")).To(Equal("main"))
+		Expect(FuncPackage("noname")).To(BeEmpty())
+	})
+
+	It("should list sorted functions only", func() {
+		ns := r.Funcs()
+		Expect(ns).ShouldNot(BeEmpty())
+		Expect(ns).Should(ContainElement("github.com/u2386/go-hijack/runtime.this_is_for_test"))
+		Expect(ns).ShouldNot(ContainElement("runtime.buildVersion"))
+		for i := 1; i < len(ns); i++ {
+			Expect(ns[i-1] <= ns[i]).Should(BeTrue())
+		}
+	})
+
+	It("should filter by package and regexp", func() {
+		c, err := r.Catalog(FuncQuery{
+			Package: "github.com/u2386/go-hijack/runtime",
+			Regexp:  `this_is_for_test$`,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(c.Total).To(Equal(1))
+
+		info := c.Funcs[0]
+		Expect(info.Name).To(Equal("github.com/u2386/go-hijack/runtime.this_is_for_test"))
+		Expect(info.Dwarf).To(BeTrue())
+		Expect(info.Patchable).To(BeTrue())
+		Expect(info.Hijacked).To(BeFalse())
+		Expect(info.Signature).To(ContainSubstring("this_is_for_test(i int)"))
+		Expect(info.File).To(HaveSuffix("runtime_suite_test.go"))
+		Expect(info.Line).ShouldNot(BeZero())
+		Expect(info.Size).ShouldNot(BeZero())
+	})
+
+	It("should paginate", func() {
+		all, err := r.Catalog(FuncQuery{Package: "github.com/u2386/go-hijack/runtime"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(all.Total > 2).Should(BeTrue())
+
+		page, err := r.Catalog(FuncQuery{Package: "github.com/u2386/go-hijack/runtime", Offset: 1, Limit: 2})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(page.Total).To(Equal(all.Total))
+		Expect(page.Funcs).To(HaveLen(2))
+		Expect(page.Funcs[0].Name).To(Equal(all.Funcs[1].Name))
+	})
+
+	It("should keep exported functions only", func() {
+		c, err := r.Catalog(FuncQuery{Package: "github.com/u2386/go-hijack/runtime", Exported: true})
+		Expect(err).ShouldNot(HaveOccurred())
+		for _, info := range c.Funcs {
+			Expect(isExported(info.Name)).Should(BeTrue())
+		}
+	})
+
+	It("should reject unknown sort", func() {
+		_, err := r.Catalog(FuncQuery{Sort: "unknown"})
+		Expect(err).To(Equal(ErrUnsupportedSort))
+	})
+})
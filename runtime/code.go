@@ -0,0 +1,160 @@
+package runtime
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+type (
+	Instruction struct {
+		Address uint64 `json:"address"`
+		Bytes   string `json:"bytes"`
+		Text    string `json:"text"`
+	}
+
+	Code struct {
+		Func     string        `json:"func"`
+		Address  uint64        `json:"address"`
+		Size     uint64        `json:"size"`
+		Hijacked bool          `json:"hijacked"`
+		Live     string        `json:"live"`
+		Prologue []Instruction `json:"prologue"`
+
+		// Set for hijacked functions only: what Patch overwrote, what it
+		// wrote, the gate in front of the replacement if any, and where the
+		// trampoline lands.
+		Original         string        `json:"original,omitempty"`
+		OriginalPrologue []Instruction `json:"original_prologue,omitempty"`
+		Patched          string        `json:"patched,omitempty"`
+		Gate             uint64        `json:"gate,omitempty"`
+		Closure          uint64        `json:"closure,omitempty"`
+		Target           uint64        `json:"target,omitempty"`
+		TargetFunc       string        `json:"target_func,omitempty"`
+		TargetCode       []Instruction `json:"target_code,omitempty"`
+	}
+)
+
+const (
+	// PrologueSize is how many bytes of a function are disassembled, and
+	// StubSize how many of the code a trampoline jumps to.
+	PrologueSize = 64
+	StubSize     = 256
+	// MaxInstructions bounds every disassembly listing.
+	MaxInstructions = 64
+)
+
+func (r *Runtime) funcSymbols() []elf.Symbol {
+	r.symOnce.Do(func() {
+		for _, sym := range r.symbols {
+			if isFunc(sym) && sym.Value != 0 {
+				r.sorted = append(r.sorted, sym)
+			}
+		}
+		sort.Slice(r.sorted, func(i, j int) bool { return r.sorted[i].Value < r.sorted[j].Value })
+	})
+	return r.sorted
+}
+
+// symbolAt returns the function symbol containing pc, including assembly
+// functions that have no DWARF.
+func (r *Runtime) symbolAt(pc uint64) (elf.Symbol, bool) {
+	syms := r.funcSymbols()
+	i := sort.Search(len(syms), func(i int) bool { return syms[i].Value > pc }) - 1
+	if i < 0 || pc >= syms[i].Value+syms[i].Size {
+		return elf.Symbol{}, false
+	}
+	return syms[i], true
+}
+
+func (r *Runtime) symname(addr uint64) (string, uint64) {
+	if sym, ok := r.symbolAt(addr); ok {
+		return sym.Name, sym.Value
+	}
+	return "", 0
+}
+
+func (r *Runtime) disassemble(code []byte, pc uint64) []Instruction {
+	var insts []Instruction
+	for len(code) > 0 && len(insts) < MaxInstructions {
+		inst, err := x86asm.Decode(code, 64)
+		if err != nil || inst.Len == 0 {
+			insts = append(insts, Instruction{Address: pc, Bytes: hex.EncodeToString(code[:1]), Text: "?"})
+			code, pc = code[1:], pc+1
+			continue
+		}
+
+		insts = append(insts, Instruction{
+			Address: pc,
+			Bytes:   hex.EncodeToString(code[:inst.Len]),
+			Text:    x86asm.GoSyntax(inst, pc, r.symname),
+		})
+		code, pc = code[inst.Len:], pc+uint64(inst.Len)
+	}
+	return insts
+}
+
+func window(size, limit uint64) int {
+	if size == 0 || size > limit {
+		return int(limit)
+	}
+	return int(size)
+}
+
+// Code shows the live machine code of a function and, when it is hijacked,
+// the bytes Patch replaced together with the code the trampoline jumps to.
+func (r *Runtime) Code(name string) (*Code, error) {
+	name, err := r.resolveName(name)
+	if err != nil {
+		return nil, err
+	}
+	sym, ok := r.symbols[name]
+	if !ok {
+		return nil, ErrPointNotFound
+	}
+
+	live := RawMemoryAccess(uintptr(sym.Value), window(sym.Size, PrologueSize))
+	c := &Code{
+		Func:     name,
+		Address:  sym.Value,
+		Size:     sym.Size,
+		Live:     hex.EncodeToString(live),
+		Prologue: r.disassemble(live, sym.Value),
+	}
+
+	v, ok := r.M.Load(name)
+	if !ok {
+		return c, nil
+	}
+	c.Hijacked = true
+
+	g, _ := v.(*Guard)
+	if g == nil || g.original == nil {
+		return c, nil
+	}
+
+	original := append([]byte{}, g.original...)
+	if len(original) < len(live) {
+		original = append(original, live[len(original):]...)
+	}
+	c.Original = hex.EncodeToString(g.original)
+	c.OriginalPrologue = r.disassemble(original, sym.Value)
+	c.Patched = hex.EncodeToString(g.patched)
+	c.Closure = uint64(g.to)
+	if t := g.trigger; t != nil && t.gate != nil && uintptr(unsafe.Pointer(t.gate)) == g.to {
+		c.Gate, c.Closure = c.Closure, uint64(t.gate.replacement)
+	}
+	c.Target = binary.LittleEndian.Uint64(RawMemoryAccess(uintptr(c.Closure), 8))
+
+	size := uint64(StubSize)
+	if target, ok := r.symbolAt(c.Target); ok {
+		c.TargetFunc = target.Name
+		size = target.Value + target.Size - c.Target
+	}
+	c.TargetCode = r.disassemble(RawMemoryAccess(uintptr(c.Target), window(size, StubSize)), c.Target)
+	return c, nil
+}
@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Function Code", func() {
+	var (
+		r      *Runtime
+		ctx    context.Context
+		cancel context.CancelFunc
+		name   = "github.com/u2386/go-hijack/runtime.test_for_two_returns"
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		r, _ = New(pid)
+		go r.Run(ctx)
+	})
+
+	AfterEach(func() {
+		r.Release(name)
+		cancel()
+	})
+
+	It("should disassemble the prologue", func() {
+		c, err := r.Code(name)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(c.Hijacked).Should(BeFalse())
+		Expect(c.Address).ShouldNot(BeZero())
+		Expect(c.Prologue).ShouldNot(BeEmpty())
+		Expect(c.Prologue[0].Address).To(Equal(c.Address))
+		Expect(c.Live).To(HavePrefix(c.Prologue[0].Bytes))
+		Expect(c.Original).To(BeEmpty())
+	})
+
+	It("should show the trampoline", func() {
+		err := r.Hijack(map[string]interface{}{"func": name, "action": "delay", "val": 1})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		c, err := r.Code(name)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(c.Hijacked).Should(BeTrue())
+		Expect(c.Live).To(HavePrefix(c.Patched))
+		Expect(c.Patched).To(HavePrefix("48ba"))
+		Expect(c.Prologue[0].Text).To(HavePrefix("MOVQ $"))
+		Expect(c.Prologue[1].Text).To(Equal("JMP 0(DX)"))
+		Expect(c.OriginalPrologue[0].Bytes).To(Equal(c.Original[:len(c.OriginalPrologue[0].Bytes)]))
+		Expect(c.Gate).ShouldNot(BeZero())
+		Expect(c.Closure).ShouldNot(BeZero())
+		Expect(c.TargetFunc).To(HavePrefix("reflect.makeFuncStub"))
+		Expect(c.TargetCode).ShouldNot(BeEmpty())
+
+		var texts []string
+		for _, inst := range c.TargetCode {
+			texts = append(texts, inst.Text)
+		}
+		Expect(strings.Join(texts, "\n")).To(ContainSubstring("CALL reflect.callReflect"))
+	})
+})
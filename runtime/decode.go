@@ -0,0 +1,347 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+var ErrDecode = errors.New("cannot decode")
+
+// Decode converts a JSON decoded value into a value of exactly typ, rejecting
+// values that do not fit instead of converting them loosely. Objects decode
+// into structs and maps, arrays into slices and arrays, null into nil, and
+// strings into errors, durations, []byte from base64 and byte arrays from hex.
+func Decode(typ reflect.Type, val interface{}) (_ reflect.Value, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%w: %v into %s", ErrDecode, e, typ)
+		}
+	}()
+
+	v := reflect.New(typ).Elem()
+	if err := decode(v, val); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, nil
+}
+
+func mismatch(v reflect.Value, val interface{}) error {
+	return fmt.Errorf("%w: %T into %s", ErrDecode, val, v.Type())
+}
+
+func number(val interface{}) (float64, bool) {
+	switch n := val.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func decode(v reflect.Value, val interface{}) error {
+	if s, ok := val.(string); ok {
+		switch v.Type() {
+		case errorType:
+			v.Set(reflect.ValueOf(errors.New(s)))
+			return nil
+		case durationType:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrDecode, err)
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+	}
+
+	if val == nil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return mismatch(v, val)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return mismatch(v, val)
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := number(val)
+		if !ok || n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 || v.OverflowInt(int64(n)) {
+			return mismatch(v, val)
+		}
+		v.SetInt(int64(n))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := number(val)
+		if !ok || n < 0 || n != math.Trunc(n) || n >= math.MaxUint64 || v.OverflowUint(uint64(n)) {
+			return mismatch(v, val)
+		}
+		v.SetUint(uint64(n))
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := number(val)
+		if !ok || v.OverflowFloat(n) {
+			return mismatch(v, val)
+		}
+		v.SetFloat(n)
+
+	case reflect.String:
+		s, ok := val.(string)
+		if !ok {
+			return mismatch(v, val)
+		}
+		v.SetString(s)
+
+	case reflect.Complex64, reflect.Complex128:
+		s, ok := val.([]interface{})
+		if !ok || len(s) != 2 {
+			return mismatch(v, val)
+		}
+		re, ok1 := number(s[0])
+		im, ok2 := number(s[1])
+		if !ok1 || !ok2 || v.OverflowComplex(complex(re, im)) {
+			return mismatch(v, val)
+		}
+		v.SetComplex(complex(re, im))
+
+	case reflect.Ptr:
+		e := reflect.New(v.Type().Elem())
+		if err := decode(e.Elem(), val); err != nil {
+			return err
+		}
+		v.Set(e)
+
+	case reflect.Map:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return mismatch(v, val)
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		for k, e := range m {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := decodeKey(key, k); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decode(elem, e); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+
+	case reflect.Interface:
+		rv := reflect.ValueOf(val)
+		if !rv.Type().AssignableTo(v.Type()) {
+			return mismatch(v, val)
+		}
+		v.Set(rv)
+
+	case reflect.Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return mismatch(v, val)
+		}
+		for k, e := range m {
+			f := fieldByKey(v, k)
+			if !f.IsValid() {
+				return fmt.Errorf("%w: no field %s in %s", ErrDecode, k, v.Type())
+			}
+			if err := decode(f, e); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Array:
+		if h, ok := val.(string); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := hex.DecodeString(strings.TrimPrefix(h, "0x"))
+			if err != nil || len(b) != v.Len() {
+				return mismatch(v, val)
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		s, ok := val.([]interface{})
+		if !ok || len(s) != v.Len() {
+			return mismatch(v, val)
+		}
+		for i, e := range s {
+			if err := decode(v.Index(i), e); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		if b64, ok := val.(string); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				return mismatch(v, val)
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		s, ok := val.([]interface{})
+		if !ok {
+			return mismatch(v, val)
+		}
+		v.Set(reflect.MakeSlice(v.Type(), len(s), len(s)))
+		for i, e := range s {
+			if err := decode(v.Index(i), e); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return mismatch(v, val)
+	}
+	return nil
+}
+
+// fieldIndex returns the field of the struct type t that an object key names,
+// by its declared name if it was rebuilt, by its json tag or case
+// insensitively by name, or -1.
+func fieldIndex(t reflect.Type, k string) int {
+	if i := dwarfField(t, k); i >= 0 {
+		return i
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if tag == k || (tag == "" && strings.EqualFold(sf.Name, k)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// fieldByKey finds the field an object key names. Unexported fields of the
+// real types are made settable through their address.
+func fieldByKey(v reflect.Value, k string) reflect.Value {
+	i := fieldIndex(v.Type(), k)
+	if i < 0 {
+		return reflect.Value{}
+	}
+
+	f := v.Field(i)
+	if !f.CanSet() && f.CanAddr() {
+		f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+	}
+	return f
+}
+
+// decodeKey converts an object key, which JSON always quotes, into a map key.
+func decodeKey(v reflect.Value, k string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(k)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(k, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			return mismatch(v, k)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(k, 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			return mismatch(v, k)
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(k)
+		if err != nil {
+			return mismatch(v, k)
+		}
+		v.SetBool(b)
+		return nil
+	}
+	return mismatch(v, k)
+}
+
+// clone copies the maps, slices and pointees held by a value decoded once, so
+// that every call it is given to gets one of its own. Errors are shared, as
+// callers compare them by identity.
+func clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type().Implements(errorType) {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(clone(v.Elem()))
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() || v.Elem().Type().Implements(errorType) {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(clone(v.Elem()))
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(clone(v.Index(i)))
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			c.SetMapIndex(it.Key(), clone(it.Value()))
+		}
+		return c
+
+	case reflect.Struct:
+		c := copyOf(v)
+		for i := 0; i < c.NumField(); i++ {
+			f := c.Field(i)
+			if !f.CanSet() {
+				f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+			}
+			f.Set(clone(f))
+		}
+		return c
+
+	case reflect.Array:
+		c := copyOf(v)
+		for i := 0; i < c.Len(); i++ {
+			e := c.Index(i)
+			e.Set(clone(e))
+		}
+		return c
+	}
+	return v
+}
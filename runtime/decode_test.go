@@ -0,0 +1,220 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type (
+	test_limits struct {
+		Burst int16 `json:"burst"`
+		rate  float32
+	}
+
+	test_config struct {
+		Name    string            `json:"name"`
+		Timeout time.Duration     `json:"timeout"`
+		Labels  map[string]string `json:"labels"`
+		Ports   map[uint16]bool   `json:"ports"`
+		Limits  *test_limits      `json:"limits"`
+		Secret  []byte            `json:"secret"`
+		Skipped int               `json:"-"`
+	}
+)
+
+//go:noinline
+func test_for_config(c *test_config, retries int8) (string, []byte, error) {
+	if c == nil {
+		return "", nil, nil
+	}
+	return c.Name, c.Secret, nil
+}
+
+var _, _, _ = test_for_config(nil, 0)
+
+func fromJSON(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+var _ = Describe("Test Decode", func() {
+	It("should decode composite values", func() {
+		v, err := Decode(reflect.TypeOf(&test_config{}), fromJSON(`{
+			"name": "api",
+			"timeout": "1.5s",
+			"labels": {"env": "prod"},
+			"ports": {"80": true, "443": false},
+			"limits": {"burst": 10, "rate": 0.5},
+			"secret": "aGVsbG8="
+		}`))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		c := v.Interface().(*test_config)
+		Expect(c.Name).To(Equal("api"))
+		Expect(c.Timeout).To(Equal(1500 * time.Millisecond))
+		Expect(c.Labels).To(Equal(map[string]string{"env": "prod"}))
+		Expect(c.Ports).To(Equal(map[uint16]bool{80: true, 443: false}))
+		Expect(c.Limits).To(Equal(&test_limits{Burst: 10, rate: 0.5}))
+		Expect(c.Secret).To(Equal([]byte("hello")))
+	})
+
+	It("should decode null, numbers, errors and complex", func() {
+		v, err := Decode(reflect.TypeOf(&test_config{}), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.IsNil()).To(BeTrue())
+
+		v, err = Decode(reflect.TypeOf(uint8(0)), 255.0)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Interface()).To(Equal(uint8(255)))
+
+		v, err = Decode(errorType, "doom")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Interface()).To(MatchError("doom"))
+
+		v, err = Decode(reflect.TypeOf(complex64(0)), []interface{}{1.0, -2.0})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Interface()).To(Equal(complex64(complex(1, -2))))
+
+		v, err = Decode(reflect.TypeOf([]uint16{}), fromJSON(`[1, 2]`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Interface()).To(Equal([]uint16{1, 2}))
+	})
+
+	It("should refuse mismatches", func() {
+		for _, c := range []struct {
+			typ reflect.Type
+			val interface{}
+		}{
+			{reflect.TypeOf(int8(0)), 128.0},
+			{reflect.TypeOf(0), 1.5},
+			{reflect.TypeOf(0), "1"},
+			{reflect.TypeOf(""), nil},
+			{reflect.TypeOf([]byte{}), "not base64!"},
+			{reflect.TypeOf(map[int]bool{}), fromJSON(`{"x": true}`)},
+			{reflect.TypeOf(test_config{}), fromJSON(`{"unknown": 1}`)},
+			{reflect.TypeOf(test_config{}), fromJSON(`{"Skipped": 1}`)},
+			{reflect.TypeOf(time.Duration(0)), "soon"},
+		} {
+			_, err := Decode(c.typ, c.val)
+			Expect(err).Should(MatchError(ErrDecode), c.typ.String())
+		}
+	})
+
+	It("should clone values but share errors", func() {
+		type holder struct {
+			Labels map[string][]int
+			limits *test_limits
+			Ports  [1][]byte
+			Err    error
+			Any    interface{}
+		}
+		v := holder{
+			Labels: map[string][]int{"a": {1}},
+			limits: &test_limits{Burst: 1},
+			Ports:  [1][]byte{[]byte("x")},
+			Err:    io.EOF,
+			Any:    map[string]interface{}{"k": "v"},
+		}
+		c := clone(reflect.ValueOf(v)).Interface().(holder)
+		Expect(c).To(Equal(v))
+
+		c.Labels["a"][0] = 2
+		c.limits.Burst = 2
+		c.Ports[0][0] = 'y'
+		c.Any.(map[string]interface{})["k"] = "w"
+		Expect(v.Labels["a"]).To(Equal([]int{1}))
+		Expect(v.limits.Burst).To(BeEquivalentTo(1))
+		Expect(v.Ports[0]).To(Equal([]byte("x")))
+		Expect(v.Any).To(Equal(map[string]interface{}{"k": "v"}))
+		Expect(c.Err).To(BeIdenticalTo(io.EOF))
+	})
+
+	Context("Test Hijack", func() {
+		const name = "github.com/u2386/go-hijack/runtime.test_for_config"
+
+		var (
+			r *Runtime
+			g *Guard
+		)
+
+		BeforeEach(func() {
+			r, _ = New(pid)
+			g = nil
+		})
+
+		AfterEach(func() {
+			if g != nil {
+				g.Unpatch()
+			}
+		})
+
+		It("should set a struct pointer from an object", func() {
+			var err error
+			g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 0, "val": fromJSON(`{"name": "patched"}`)})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			s, _, _ := test_for_config(&test_config{Name: "origin"}, 0)
+			Expect(s).To(Equal("patched"))
+		})
+
+		It("should give every call a value of its own", func() {
+			var err error
+			g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 0, "val": fromJSON(`{"secret": "aGVsbG8="}`)})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, b, _ := test_for_config(nil, 0)
+			b[0] = 'j'
+			_, b, _ = test_for_config(nil, 0)
+			Expect(b).To(Equal([]byte("hello")))
+		})
+
+		It("should return bytes and errors", func() {
+			var err error
+			g, err = (&patcher{}).Return(r, map[string]interface{}{"func": name, "index": 1, "val": "aGVsbG8="})
+			Expect(err).ShouldNot(HaveOccurred())
+			_, b, _ := test_for_config(nil, 0)
+			Expect(b).To(Equal([]byte("hello")))
+			b[0] = 'j'
+			_, b, _ = test_for_config(nil, 0)
+			Expect(b).To(Equal([]byte("hello")))
+			g.Unpatch()
+
+			g, err = (&patcher{}).Return(r, map[string]interface{}{"func": name, "index": 2, "val": "doom"})
+			Expect(err).ShouldNot(HaveOccurred())
+			_, _, e := test_for_config(nil, 0)
+			Expect(e).To(MatchError("doom"))
+			_, _, again := test_for_config(nil, 0)
+			Expect(again).To(BeIdenticalTo(e))
+		})
+
+		It("should refuse mismatches before patching", func() {
+			var err error
+			for _, point := range []map[string]interface{}{
+				{"func": name, "index": 1, "val": 300.0},
+				{"func": name, "index": 0, "val": "config"},
+				{"func": name, "index": 2, "val": 1.0},
+			} {
+				g, err = (&patcher{}).Set(r, point)
+				if point["index"] == 2 {
+					Expect(err).Should(MatchError(ErrUnsupportAction))
+				} else {
+					Expect(err).Should(MatchError(ErrDecode))
+				}
+				Expect(g).To(BeNil())
+			}
+
+			g, err = (&patcher{}).Return(r, map[string]interface{}{"func": name, "index": 3, "val": nil})
+			Expect(err).Should(MatchError(ErrUnsupportAction))
+			Expect(errors.Is(err, ErrDecode)).To(BeFalse())
+		})
+	})
+})
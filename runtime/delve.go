@@ -67,3 +67,59 @@ func DwarfTree(dw *dwarf.Data) (map[string]*godwarf.Tree, error) {
 	}
 	return ts, nil
 }
+
+func DeclFiles(dw *dwarf.Data) (map[dwarf.Offset]string, error) {
+	reader := dw.Reader()
+
+	var files []*dwarf.LineFile
+	fs := make(map[dwarf.Offset]string)
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		switch entry.Tag {
+		case dwarf.TagCompileUnit:
+			files = nil
+			lr, err := dw.LineReader(entry)
+			if err != nil {
+				return nil, err
+			}
+			if lr != nil {
+				files = lr.Files()
+			}
+
+		case dwarf.TagSubprogram:
+			idx, ok := entry.Val(dwarf.AttrDeclFile).(int64)
+			if !ok || idx < 0 || int(idx) >= len(files) || files[idx] == nil {
+				continue
+			}
+			fs[entry.Offset] = files[idx].Name
+		}
+	}
+	return fs, nil
+}
+
+func DwarfVars(dw *dwarf.Data) (map[string]*dwarf.Entry, error) {
+	reader := dw.Reader()
+
+	vs := make(map[string]*dwarf.Entry)
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		switch entry.Tag {
+		case dwarf.TagCompileUnit:
+			continue
+		case dwarf.TagVariable:
+			if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+				vs[name] = entry
+			}
+		}
+		if entry.Children {
+			reader.SkipChildren()
+		}
+	}
+	return vs, nil
+}
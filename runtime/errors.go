@@ -0,0 +1,249 @@
+package runtime
+
+import (
+	"context"
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type (
+	// ErrorSpec describes an error to construct. Errno makes a
+	// syscall.Errno, URL a *url.Error, Net or Timeout a *net.OpError, and Msg
+	// alone a plain error. Err is the wrapped error, given as a name, a
+	// message or another ErrorSpec, and Msg with Err makes a `msg: %w` chain.
+	ErrorSpec struct {
+		Msg     string
+		Errno   interface{}
+		Op      string
+		Net     string
+		Addr    string
+		URL     string
+		Timeout bool
+		Err     interface{}
+	}
+)
+
+var (
+	ErrUnknownError = errors.New("unknown error")
+
+	// sentinelRegexp matches strings spelled like a sentinel, such as
+	// `pkg.ErrX`, `github.com/org/pkg.ErrX` or `ENOENT`, as opposed to
+	// messages.
+	sentinelRegexp = regexp.MustCompile(`^([\w.\-]+/)*\w+\.[A-Za-z_]\w*$|^E[A-Z0-9]+$`)
+
+	// sentinels are resolved without DWARF, by the names used in Go code.
+	sentinels = map[string]error{
+		"context.Canceled":         context.Canceled,
+		"context.DeadlineExceeded": context.DeadlineExceeded,
+		"io.EOF":                   io.EOF,
+		"io.ErrUnexpectedEOF":      io.ErrUnexpectedEOF,
+		"io.ErrClosedPipe":         io.ErrClosedPipe,
+		"io.ErrShortWrite":         io.ErrShortWrite,
+		"os.ErrNotExist":           os.ErrNotExist,
+		"os.ErrExist":              os.ErrExist,
+		"os.ErrPermission":         os.ErrPermission,
+		"os.ErrClosed":             os.ErrClosed,
+		"os.ErrDeadlineExceeded":   os.ErrDeadlineExceeded,
+		"net.ErrClosed":            net.ErrClosed,
+	}
+
+	errnos = map[string]syscall.Errno{
+		"EACCES":       syscall.EACCES,
+		"EADDRINUSE":   syscall.EADDRINUSE,
+		"EAGAIN":       syscall.EAGAIN,
+		"EBADF":        syscall.EBADF,
+		"ECONNABORTED": syscall.ECONNABORTED,
+		"ECONNREFUSED": syscall.ECONNREFUSED,
+		"ECONNRESET":   syscall.ECONNRESET,
+		"EEXIST":       syscall.EEXIST,
+		"EHOSTUNREACH": syscall.EHOSTUNREACH,
+		"EINTR":        syscall.EINTR,
+		"EINVAL":       syscall.EINVAL,
+		"EIO":          syscall.EIO,
+		"EMFILE":       syscall.EMFILE,
+		"ENETUNREACH":  syscall.ENETUNREACH,
+		"ENOENT":       syscall.ENOENT,
+		"ENOSPC":       syscall.ENOSPC,
+		"EPERM":        syscall.EPERM,
+		"EPIPE":        syscall.EPIPE,
+		"ETIMEDOUT":    syscall.ETIMEDOUT,
+	}
+)
+
+// sentinel resolves a package-level error variable such as `sql.ErrNoRows` by
+// its symbol name, or a unique suffix of it, and returns the value it holds,
+// so that errors.Is in callers matches.
+func (r *Runtime) sentinel(name string) (error, bool) {
+	if err, ok := sentinels[name]; ok {
+		return err, true
+	}
+	if errno, ok := errnos[name]; ok {
+		return errno, true
+	}
+
+	vars := r.vars()
+	if _, ok := vars[name]; !ok {
+		var found []string
+		for v := range vars {
+			if strings.HasSuffix(v, "/"+name) {
+				found = append(found, v)
+			}
+		}
+		if len(found) != 1 {
+			sort.Strings(found)
+			debug("sentinel %s:%v", name, found)
+			return nil, false
+		}
+		name = found[0]
+	}
+
+	_, v, err := r.varValue(name)
+	if err != nil || v.Kind() != reflect.Interface || v.IsNil() {
+		return nil, false
+	}
+	e, ok := v.Interface().(error)
+	return e, ok
+}
+
+// closestSentinel returns the known sentinel name closest to name, if any is
+// close enough to be a likely misspelling.
+func (r *Runtime) closestSentinel(name string) (string, bool) {
+	var names []string
+	for n := range sentinels {
+		names = append(names, n)
+	}
+	for n := range errnos {
+		names = append(names, n)
+	}
+	for v, entry := range r.vars() {
+		off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			continue
+		}
+		if typ, err := r.types.ReadType(off); err == nil && typ.String() == "error" {
+			names = append(names, v)
+		}
+	}
+	sort.Strings(names)
+
+	// A name is compared with and without its package, so that `EOF` is
+	// taken for io.EOF.
+	short := normalize(name)
+	best, distance := "", len(short)/3+1
+	for _, n := range names {
+		for _, m := range []string{normalize(n), member(n)} {
+			if d := levenshtein(short, m); d < distance {
+				best, distance = n, d
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// MakeError constructs the error described by spec: null for no error, a
+// sentinel name such as `io.EOF`, `ECONNRESET` or `sql.ErrNoRows`, any other
+// string as a message, or an ErrorSpec object. A string spelled like a
+// sentinel that names none is refused rather than taken as a message.
+func (r *Runtime) MakeError(spec interface{}) (error, error) {
+	switch s := spec.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if !sentinelRegexp.MatchString(s) {
+			return errors.New(s), nil
+		}
+		if err, ok := r.sentinel(s); ok {
+			return err, nil
+		}
+		if n, ok := r.closestSentinel(s); ok {
+			return nil, fmt.Errorf("%w: %s, did you mean %s?", ErrUnknownError, s, n)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownError, s)
+	case map[string]interface{}:
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownError, spec)
+	}
+
+	var es ErrorSpec
+	if err := mapstructure.Decode(spec, &es); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownError, err)
+	}
+
+	inner, err := r.MakeError(es.Err)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case es.Errno != nil:
+		return makeErrno(es.Errno)
+
+	case es.URL != "":
+		return &url.Error{Op: es.Op, URL: es.URL, Err: inner}, nil
+
+	case es.Net != "" || es.Timeout:
+		if es.Timeout && inner == nil {
+			inner = os.ErrDeadlineExceeded
+		}
+		if inner == nil {
+			return nil, fmt.Errorf("%w: net error without err", ErrUnknownError)
+		}
+		oe := &net.OpError{Op: es.Op, Net: es.Net, Err: inner}
+		if es.Addr != "" {
+			addr, err := net.ResolveTCPAddr("tcp", es.Addr)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownError, err)
+			}
+			oe.Addr = addr
+		}
+		return oe, nil
+
+	case es.Msg != "" && inner != nil:
+		return fmt.Errorf("%s: %w", es.Msg, inner), nil
+
+	case es.Msg != "":
+		return errors.New(es.Msg), nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownError, spec)
+}
+
+func makeErrno(v interface{}) (error, error) {
+	if s, ok := v.(string); ok {
+		if errno, ok := errnos[s]; ok {
+			return errno, nil
+		}
+		return nil, fmt.Errorf("%w: errno %s", ErrUnknownError, s)
+	}
+	if n, ok := number(v); ok && n > 0 && n == float64(int(n)) {
+		return syscall.Errno(n), nil
+	}
+	return nil, fmt.Errorf("%w: errno %v", ErrUnknownError, v)
+}
+
+// decode is Decode, constructing errors with MakeError.
+func (r *Runtime) decode(typ reflect.Type, val interface{}) (reflect.Value, error) {
+	if typ != errorType {
+		return Decode(typ, val)
+	}
+	err, e := r.MakeError(val)
+	if e != nil {
+		return reflect.Value{}, e
+	}
+	v := reflect.New(errorType).Elem()
+	if err != nil {
+		v.Set(reflect.ValueOf(err))
+	}
+	return v, nil
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var test_err_sentinel = errors.New("sentinel")
+
+var _ = Describe("Test Make Error", func() {
+	var r *Runtime
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	build := func(spec interface{}) error {
+		err, e := r.MakeError(spec)
+		Expect(e).ShouldNot(HaveOccurred())
+		return err
+	}
+
+	It("should resolve sentinels", func() {
+		Expect(build(nil)).To(BeNil())
+		Expect(build("context.DeadlineExceeded")).To(Equal(context.DeadlineExceeded))
+		Expect(build("io.EOF")).To(Equal(io.EOF))
+		Expect(errors.Is(build("os.ErrNotExist"), os.ErrNotExist)).To(BeTrue())
+		Expect(build("ECONNRESET")).To(Equal(syscall.ECONNRESET))
+		Expect(build("runtime.test_err_sentinel")).To(BeIdenticalTo(test_err_sentinel))
+		Expect(build("github.com/u2386/go-hijack/runtime.test_err_sentinel")).To(BeIdenticalTo(test_err_sentinel))
+		Expect(build("boom")).To(MatchError("boom"))
+	})
+
+	It("should construct errors", func() {
+		err := build(map[string]interface{}{"errno": "ENOSPC"})
+		Expect(errors.Is(err, syscall.ENOSPC)).To(BeTrue())
+		Expect(build(map[string]interface{}{"errno": 104.0})).To(Equal(syscall.ECONNRESET))
+
+		err = build(map[string]interface{}{"op": "dial", "net": "tcp", "addr": "10.0.0.1:443", "timeout": true})
+		var oe *net.OpError
+		Expect(errors.As(err, &oe)).To(BeTrue())
+		Expect(oe.Timeout()).To(BeTrue())
+		Expect(oe.Addr.String()).To(Equal("10.0.0.1:443"))
+		Expect(errors.Is(err, os.ErrDeadlineExceeded)).To(BeTrue())
+
+		err = build(map[string]interface{}{"op": "read", "net": "tcp", "err": "ECONNRESET"})
+		Expect(errors.Is(err, syscall.ECONNRESET)).To(BeTrue())
+
+		err = build(map[string]interface{}{"op": "Get", "url": "http://api/users", "err": "context.DeadlineExceeded"})
+		var ue *url.Error
+		Expect(errors.As(err, &ue)).To(BeTrue())
+		Expect(ue.Timeout()).To(BeTrue())
+
+		err = build(map[string]interface{}{"msg": "load user", "err": map[string]interface{}{"msg": "query", "err": "io.EOF"}})
+		Expect(err).To(MatchError("load user: query: EOF"))
+		Expect(errors.Is(err, io.EOF)).To(BeTrue())
+	})
+
+	It("should refuse unknown errors", func() {
+		for _, spec := range []interface{}{
+			1.0,
+			map[string]interface{}{"errno": "ENOPE"},
+			map[string]interface{}{"net": "tcp"},
+			map[string]interface{}{},
+			"io.EOFF",
+			"ECONNREST",
+		} {
+			_, err := r.MakeError(spec)
+			Expect(err).Should(MatchError(ErrUnknownError))
+		}
+	})
+
+	It("should suggest the closest sentinel", func() {
+		_, err := r.MakeError("context.DeadlineExeeded")
+		Expect(err).Should(MatchError(ErrUnknownError))
+		Expect(err.Error()).Should(HaveSuffix("did you mean context.DeadlineExceeded?"))
+
+		_, err = r.MakeError("EOF")
+		Expect(err.Error()).Should(HaveSuffix("did you mean io.EOF?"))
+
+		_, err = r.MakeError("runtime.test_err_sentinal")
+		Expect(err.Error()).Should(HaveSuffix("did you mean github.com/u2386/go-hijack/runtime.test_err_sentinel?"))
+
+		Expect(build("connection reset by peer")).To(MatchError("connection reset by peer"))
+	})
+
+	It("should return errors from hijacked functions", func() {
+		g, err := (&patcher{}).Return(r, map[string]interface{}{
+			"func":  "github.com/u2386/go-hijack/runtime.test_for_two_returns",
+			"index": 1,
+			"val":   map[string]interface{}{"op": "dial", "net": "tcp", "timeout": true},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		_, e := test_for_two_returns(0)
+		var ne net.Error
+		Expect(errors.As(e, &ne)).To(BeTrue())
+		Expect(ne.Timeout()).To(BeTrue())
+	})
+})
@@ -0,0 +1,445 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultDepth  = 3
+	DefaultLength = 64
+	DefaultBytes  = 4096
+
+	truncated = "..."
+	redacted  = "[redacted]"
+	cycle     = "<cycle>"
+)
+
+// DefaultRedact matches the names of fields and map keys whose values are
+// never shown.
+var DefaultRedact = regexp.MustCompile(`(?i)passw(or)?d|secret|token|credential|api_?key`)
+
+type (
+	// Formatter renders values of reconstructed types safely. It follows
+	// pointers and containers up to Depth levels, keeps at most Length
+	// elements or bytes of each slice, map and string and about Bytes of
+	// output in all, marks cycles instead of following them, and hides the
+	// values of fields and map keys whose names match Redact. A zero Bytes or
+	// a nil Redact disables that rule.
+	//
+	// Maps are shown by length and address unless Maps is set: reading the
+	// entries of a live map that another goroutine writes to can crash the
+	// whole process, so following them is left to callers that know the map
+	// is not being written.
+	Formatter struct {
+		Depth  int
+		Length int
+		Bytes  int
+		Redact *regexp.Regexp
+		Maps   bool
+	}
+
+	// mark stands for something left out, and is never quoted in text.
+	mark string
+
+	// entries are the fields of a struct or the entries of a map, in order.
+	entries []entry
+
+	entry struct {
+		key string
+		val interface{}
+	}
+
+	formatter struct {
+		*Formatter
+		budget int
+		seen   map[visit]bool
+	}
+
+	visit struct {
+		ptr uintptr
+		typ reflect.Type
+	}
+)
+
+func NewFormatter() *Formatter {
+	return &Formatter{
+		Depth:  DefaultDepth,
+		Length: DefaultLength,
+		Bytes:  DefaultBytes,
+		Redact: DefaultRedact,
+	}
+}
+
+// Render converts a value into JSON friendly data, following pointers and
+// containers up to depth levels and keeping at most length elements or bytes
+// of each slice and string. Maps are shown by length and address.
+func Render(v reflect.Value, depth, length int) (interface{}, error) {
+	f := NewFormatter()
+	f.Depth, f.Length = depth, length
+	return f.Value(v)
+}
+
+// Value renders v as JSON friendly data.
+func (f *Formatter) Value(v reflect.Value) (interface{}, error) {
+	out, err := f.format(v)
+	return plain(out), err
+}
+
+// JSON renders v as JSON, with struct fields in their declared order.
+func (f *Formatter) JSON(v reflect.Value) ([]byte, error) {
+	out, err := f.format(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// Text renders v for humans, as in `{Name: "api", Tags: ["a", ...]}`.
+func (f *Formatter) Text(v reflect.Value) (string, error) {
+	out, err := f.format(v)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	text(&sb, out)
+	return sb.String(), nil
+}
+
+func (f *Formatter) format(v reflect.Value) (out interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			out, err = nil, fmt.Errorf("render %s: %v", v.Type(), e)
+		}
+	}()
+	s := &formatter{Formatter: f, budget: f.Bytes, seen: make(map[visit]bool)}
+	return s.format(v, f.Depth), nil
+}
+
+// spend takes n bytes from the output budget, and reports whether there were
+// any left.
+func (s *formatter) spend(n int) bool {
+	if s.Bytes <= 0 {
+		return true
+	}
+	if s.budget <= 0 {
+		return false
+	}
+	s.budget -= n
+	return true
+}
+
+func (s *formatter) exhausted() bool {
+	return s.Bytes > 0 && s.budget <= 0
+}
+
+func (s *formatter) redact(name string) bool {
+	return s.Redact != nil && s.Redact.MatchString(name)
+}
+
+// enter records a visit to the memory at v, and reports false if it is
+// already being rendered further up.
+func (s *formatter) enter(v reflect.Value) (func(), bool) {
+	k := visit{v.Pointer(), v.Type()}
+	if k.ptr == 0 {
+		return func() {}, true
+	}
+	if s.seen[k] {
+		return nil, false
+	}
+	s.seen[k] = true
+	return func() { delete(s.seen, k) }, true
+}
+
+func (s *formatter) format(v reflect.Value, depth int) interface{} {
+	if !s.spend(1) {
+		return mark(truncated)
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+
+	case reflect.Bool:
+		return v.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.spend(8)
+		return v.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.spend(8)
+		return v.Uint()
+
+	case reflect.Float32, reflect.Float64:
+		s.spend(8)
+		return v.Float()
+
+	case reflect.Complex64, reflect.Complex128:
+		s.spend(16)
+		return mark(fmt.Sprint(v.Complex()))
+
+	case reflect.String:
+		str := v.String()
+		if len(str) > s.Length {
+			str = str[:s.Length] + truncated
+		}
+		s.spend(len(str))
+		return str
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if depth <= 0 {
+			return mark(truncated)
+		}
+		if v.Kind() == reflect.Ptr {
+			leave, ok := s.enter(v)
+			if !ok {
+				return mark(cycle)
+			}
+			defer leave()
+		}
+		return s.format(v.Elem(), depth-1)
+
+	case reflect.Struct:
+		if depth <= 0 {
+			return mark(truncated)
+		}
+		var m entries
+		for i := 0; i < v.NumField(); i++ {
+			if s.exhausted() {
+				m = append(m, entry{truncated, v.NumField() - i})
+				break
+			}
+			name := v.Type().Field(i).Name
+			s.spend(len(name))
+			if s.redact(name) {
+				m = append(m, entry{name, mark(redacted)})
+				continue
+			}
+			m = append(m, entry{name, s.format(v.Field(i), depth-1)})
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if depth <= 0 {
+			return mark(truncated)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return s.bytes(v)
+		}
+		if v.Kind() == reflect.Slice {
+			leave, ok := s.enter(v)
+			if !ok {
+				return mark(cycle)
+			}
+			defer leave()
+		}
+		l := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			if i == s.Length || s.exhausted() {
+				l = append(l, mark(truncated))
+				break
+			}
+			l = append(l, s.format(v.Index(i), depth-1))
+		}
+		return l
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if !s.Maps {
+			s.spend(24)
+			return mark(fmt.Sprintf("%s(len=%d, %#x)", v.Type(), v.Len(), v.Pointer()))
+		}
+		if depth <= 0 {
+			return mark(truncated)
+		}
+		leave, ok := s.enter(v)
+		if !ok {
+			return mark(cycle)
+		}
+		defer leave()
+
+		keys := v.MapKeys()
+		sort.SliceStable(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+
+		var m entries
+		for i, key := range keys {
+			if i == s.Length || s.exhausted() {
+				m = append(m, entry{truncated, len(keys) - i})
+				break
+			}
+			name, secret := s.key(key, depth-1)
+			if secret {
+				m = append(m, entry{name, mark(redacted)})
+				continue
+			}
+			m = append(m, entry{name, s.format(v.MapIndex(key), depth-1)})
+		}
+		return m
+
+	default:
+		// Channels, functions and unsafe pointers are shown by address.
+		s.spend(24)
+		return mark(fmt.Sprintf("%s(%#x)", v.Type(), v.Pointer()))
+	}
+}
+
+// bytes renders a byte slice or array as a string when it is printable text,
+// or else in hex.
+func (s *formatter) bytes(v reflect.Value) interface{} {
+	n := v.Len()
+	if n > s.Length {
+		n = s.Length
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(v.Index(i).Uint())
+	}
+
+	str := "0x" + hex.EncodeToString(b)
+	if utf8.Valid(b) && strings.IndexFunc(string(b), func(r rune) bool {
+		return !unicode.IsPrint(r) && !unicode.IsSpace(r)
+	}) < 0 {
+		str = string(b)
+	}
+	if n < v.Len() {
+		str += truncated
+	}
+	s.spend(len(str))
+	return str
+}
+
+// key renders a map key as the name of its entry, and reports whether the
+// entry is redacted. Keys are rendered like any other value, so that they keep
+// to the same limits and never run a String method, but a string key is
+// matched against Redact in full.
+func (s *formatter) key(key reflect.Value, depth int) (string, bool) {
+	if key.Kind() == reflect.Interface {
+		key = key.Elem()
+	}
+	out := s.format(key, depth)
+	if str, ok := out.(string); ok {
+		return str, s.redact(str) || s.redact(key.String())
+	}
+	var sb strings.Builder
+	text(&sb, out)
+	return sb.String(), s.redact(sb.String())
+}
+
+// lessKey orders map keys of basic kinds by value, and others by kind only.
+func lessKey(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	if a.Kind() != b.Kind() {
+		return a.Kind() < b.Kind()
+	}
+
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	return false
+}
+
+func (m entries) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.key)
+		v, err := json.Marshal(e.val)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// plain turns rendered data into maps, slices and scalars only.
+func plain(out interface{}) interface{} {
+	switch out := out.(type) {
+	case mark:
+		return string(out)
+	case entries:
+		m := make(map[string]interface{}, len(out))
+		for _, e := range out {
+			m[e.key] = plain(e.val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(out))
+		for i, e := range out {
+			l[i] = plain(e)
+		}
+		return l
+	}
+	return out
+}
+
+func text(sb *strings.Builder, out interface{}) {
+	switch out := out.(type) {
+	case nil:
+		sb.WriteString("nil")
+	case mark:
+		sb.WriteString(string(out))
+	case string:
+		sb.WriteString(strconv.Quote(out))
+	case entries:
+		sb.WriteByte('{')
+		for i, e := range out {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(e.key)
+			sb.WriteString(": ")
+			text(sb, e.val)
+		}
+		sb.WriteByte('}')
+	case []interface{}:
+		sb.WriteByte('[')
+		for i, e := range out {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			text(sb, e)
+		}
+		sb.WriteByte(']')
+	default:
+		fmt.Fprint(sb, out)
+	}
+}
@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type test_format_node struct {
+	Name     string
+	Password string
+	next     *test_format_node
+	Attrs    map[string]interface{}
+}
+
+type test_format_key struct {
+	ID string
+}
+
+func (test_format_key) String() string {
+	panic("String must not be called")
+}
+
+var _ = Describe("Test Formatter", func() {
+	var f *Formatter
+
+	BeforeEach(func() {
+		f = NewFormatter()
+		f.Maps = true
+	})
+
+	It("should not follow maps unless asked to", func() {
+		f.Maps = false
+		s, err := f.Text(reflect.ValueOf(map[string]int{"a": 1}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(MatchRegexp(`^map\[string\]int\(len=1, 0x[0-9a-f]+\)$`))
+	})
+
+	It("should mark cycles and redact secrets", func() {
+		n := &test_format_node{Name: "a", Password: "hunter2"}
+		n.next = n
+		n.Attrs = map[string]interface{}{"api_key": "k", "self": n.Attrs}
+
+		s, err := f.Text(reflect.ValueOf(n))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{Name: "a", Password: [redacted], next: <cycle>, Attrs: {api_key: [redacted], self: ...}}`))
+
+		n.Attrs["self"] = n.Attrs
+		f.Depth = 10
+		s, err = f.Text(reflect.ValueOf(n.Attrs))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{api_key: [redacted], self: <cycle>}`))
+
+		f.Redact = regexp.MustCompile(`^Name$`)
+		s, err = f.Text(reflect.ValueOf(*n))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(HavePrefix(`{Name: [redacted], Password: "hunter2", next: {Name: [redacted]`))
+	})
+
+	It("should keep to the limits", func() {
+		f.Length = 3
+		s, err := f.Text(reflect.ValueOf([]int{1, 2, 3, 4}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`[1, 2, 3, ...]`))
+
+		f.Length, f.Bytes = DefaultLength, 64
+		s, err = f.Text(reflect.ValueOf(strings.Split(strings.Repeat("word ", 100), " ")))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(len(s)).To(BeNumerically("<", 128))
+		Expect(s).To(HaveSuffix(`"word", ...]`))
+
+		f.Bytes, f.Depth = 0, 1
+		s, err = f.Text(reflect.ValueOf(map[string][]int{"a": {1}}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{a: ...}`))
+	})
+
+	It("should render map keys as values", func() {
+		f.Length = 4
+		s, err := f.Text(reflect.ValueOf(map[test_format_key]int{{"a"}: 1}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{{ID: "a"}: 1}`))
+
+		s, err = f.Text(reflect.ValueOf(map[string]int{"abcdefg": 1, "token": 2}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{abcd...: 1, toke...: [redacted]}`))
+
+		s, err = f.Text(reflect.ValueOf(map[int]string{10: "b", 9: "a"}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{9: "a", 10: "b"}`))
+	})
+
+	It("should render bytes, channels and unsafe pointers", func() {
+		f.Length = 4
+		s, err := f.Text(reflect.ValueOf(struct {
+			Body []byte
+			ID   [3]byte
+			C    chan int
+			P    unsafe.Pointer
+		}{Body: []byte("hello"), ID: [3]byte{0, 1, 0xff}}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s).To(Equal(`{Body: "hell...", ID: "0x0001ff", C: chan int(0x0), P: unsafe.Pointer(0x0)}`))
+	})
+
+	It("should render JSON in field order", func() {
+		b, err := f.JSON(reflect.ValueOf(test_var_config{Name: "x", Tags: []string{"a"}, Limits: map[string]int{"b": 2, "a": 1}}))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(b)).To(Equal(`{"Name":"x","Retries":0,"Tags":["a"],"Limits":{"a":1,"b":2}}`))
+
+		v, err := f.Value(reflect.ValueOf(complex(1, 2)))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v).To(Equal("(1+2i)"))
+	})
+})
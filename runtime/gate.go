@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+const (
+	// maxAhead bounds the calls a gate is let through at once.
+	maxAhead = 1 << 32
+	// maxDraws bounds the draws made ahead for a point that fires on a share
+	// of the calls, so that a call the gate stops spends little more than it
+	// would drawing for itself.
+	maxDraws = 1 << 10
+
+	// trampolineSlot is the room a trampoline has in executable memory.
+	trampolineSlot = 64
+)
+
+type (
+	// gate stands in front of the reflect.MakeFunc replacement of a hijacked
+	// function. The patch jumps to it as to a closure, with DX pointing at
+	// it, and gateStub passes the call straight to the original through the
+	// trampoline while skip lasts, or else hands it to the replacement. The
+	// trigger sets skip to the number of calls it knows not to fire, which
+	// then cost an atomic add instead of reflection and two rounds of
+	// patching.
+	//
+	// gateStub knows the layout of the fields up to trampoline.
+	gate struct {
+		code        uintptr
+		skip        int64
+		replacement uintptr
+		trampoline  uintptr
+
+		fn interface{}
+	}
+
+	// codeArena hands out slots of executable memory for trampolines. Slots
+	// are never given back, as a call may still be running in one after its
+	// point was released.
+	codeArena struct {
+		mu   sync.Mutex
+		free []byte
+	}
+)
+
+var trampolines codeArena
+
+// gateStub is entered from a patch with DX pointing at a gate.
+func gateStub()
+
+// gateStubPC returns the address of gateStub itself, rather than of the
+// wrapper a Go reference to it would get.
+func gateStubPC() uintptr
+
+// newGate builds the gate for the function at from, or returns nil if the
+// instructions the patch overwrites cannot be moved to a trampoline.
+func newGate(from uintptr, replacement reflect.Value) *gate {
+	code, ok := relocate(RawMemoryAccess(from, 32), from)
+	if !ok {
+		return nil
+	}
+	tramp, ok := trampolines.alloc(code)
+	if !ok {
+		return nil
+	}
+
+	fn := replacement.Interface()
+	return &gate{code: gateStubPC(), replacement: GetPtr(&fn), trampoline: tramp, fn: fn}
+}
+
+// pass lets the next n calls through to the original.
+func (g *gate) pass(n uint64) {
+	if g != nil && n > 0 {
+		atomic.AddInt64(&g.skip, int64(n))
+	}
+}
+
+// passing returns the number of calls the gate is still to let through.
+func (g *gate) passing() uint64 {
+	if g == nil {
+		return 0
+	}
+	if n := atomic.LoadInt64(&g.skip); n > 0 {
+		return uint64(n)
+	}
+	return 0
+}
+
+// relocate copies the instructions at pc that the patch overwrites, followed
+// by a jump to the instruction after them. Conditional branches, which Go
+// prologues take to grow the stack, are rewritten to jump absolutely. Other
+// instructions addressing code or data relative to themselves are refused, as
+// are calls, which would leave a return address the runtime does not know.
+func relocate(code []byte, pc uintptr) ([]byte, bool) {
+	var out []byte
+	n := 0
+	for n < trampolineSize {
+		inst, err := x86asm.Decode(code[n:], 64)
+		if err != nil || inst.Len == 0 {
+			return nil, false
+		}
+		switch {
+		case inst.PCRel == 0:
+			out = append(out, code[n:n+inst.Len]...)
+
+		case isJcc(inst.Op):
+			rel, ok := inst.Args[0].(x86asm.Rel)
+			if !ok {
+				return nil, false
+			}
+			// The condition is the low nibble of 7x rel8 and of 0F 8x rel32.
+			cc := code[n+inst.PCRelOff-1] & 0x0F
+			target := pc + uintptr(n+inst.Len) + uintptr(int64(rel))
+			// The inverted condition skips the absolute jump that follows.
+			out = append(out, 0x70|cc^1, 14)
+			out = jumpTo(out, target)
+
+		default:
+			return nil, false
+		}
+		n += inst.Len
+	}
+
+	out = jumpTo(out, pc+uintptr(n))
+	return out, len(out) <= trampolineSlot
+}
+
+// jumpTo appends `jmp [rip+0]` followed by the address to jump to.
+func jumpTo(code []byte, target uintptr) []byte {
+	var addr [8]byte
+	binary.LittleEndian.PutUint64(addr[:], uint64(target))
+	code = append(code, 0xFF, 0x25, 0, 0, 0, 0)
+	return append(code, addr[:]...)
+}
+
+func isJcc(op x86asm.Op) bool {
+	switch op {
+	case x86asm.JA, x86asm.JAE, x86asm.JB, x86asm.JBE, x86asm.JE, x86asm.JG, x86asm.JGE, x86asm.JL,
+		x86asm.JLE, x86asm.JNE, x86asm.JNO, x86asm.JNP, x86asm.JNS, x86asm.JO, x86asm.JP, x86asm.JS:
+		return true
+	}
+	return false
+}
+
+// alloc copies code into a slot of its own, and returns its address.
+func (a *codeArena) alloc(code []byte) (uintptr, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.free) < trampolineSlot {
+		mem, err := syscall.Mmap(-1, 0, syscall.Getpagesize(), syscall.PROT_READ|syscall.PROT_EXEC, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+		if err != nil {
+			return 0, false
+		}
+		a.free = mem
+	}
+	addr := uintptr(unsafe.Pointer(&a.free[0]))
+	a.free = a.free[trampolineSlot:]
+
+	CopyToLocation(addr, code)
+	return addr, true
+}
@@ -0,0 +1,29 @@
+#include "textflag.h"
+
+// func gateStub()
+//
+// Entered from a patch with DX pointing at a gate and the arguments of the
+// hijacked call in place, so it only uses R12, which no argument is passed in.
+TEXT ·gateStub(SB), NOSPLIT|NOFRAME, $0-0
+	MOVQ	$-1, R12
+	LOCK
+	XADDQ	R12, 8(DX)	// gate.skip
+	TESTQ	R12, R12
+	JLE	slow
+	MOVQ	24(DX), R12	// gate.trampoline
+	JMP	R12
+
+slow:
+	// Give back what was not there to take, and enter the replacement with
+	// its closure context in DX.
+	LOCK
+	INCQ	8(DX)
+	MOVQ	16(DX), DX	// gate.replacement
+	MOVQ	0(DX), R12
+	JMP	R12
+
+// func gateStubPC() uintptr
+TEXT ·gateStubPC(SB), NOSPLIT, $0-8
+	MOVQ	$·gateStub(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
@@ -0,0 +1,47 @@
+package runtime
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Gate", func() {
+	const pc = 0x401000
+
+	It("should move a prologue to a trampoline", func() {
+		// CMPQ SP, 0x10(R14); JBE morestack; PUSHQ BP; MOVQ SP, BP
+		code, _ := hex.DecodeString("493b66100f8620000000554889e5")
+		out, ok := relocate(code, pc)
+		Expect(ok).To(BeTrue())
+
+		Expect(hex.EncodeToString(out)).To(Equal("493b6610" +
+			"770e" + "ff2500000000" + "2a10400000000000" +
+			"554889e5" +
+			"ff2500000000" + "0e10400000000000"))
+	})
+
+	It("should refuse code that cannot move", func() {
+		for _, s := range []string{
+			"488d0500000000554889e5909090", // LEAQ 0(IP), AX
+			"e800000000554889e590909090",   // CALL
+			"eb0c909090909090909090909090", // JMP
+		} {
+			code, _ := hex.DecodeString(s)
+			_, ok := relocate(code, pc)
+			Expect(ok).To(BeFalse(), s)
+		}
+	})
+
+	It("should count the calls it lets through", func() {
+		var g *gate
+		g.pass(1)
+		Expect(g.passing()).To(BeZero())
+
+		g = &gate{skip: -1}
+		Expect(g.passing()).To(BeZero())
+		g.pass(3)
+		Expect(g.passing()).To(BeEquivalentTo(2))
+	})
+})
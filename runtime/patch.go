@@ -3,10 +3,14 @@ package runtime
 import (
 	"errors"
 	"reflect"
+	"sync"
 	"syscall"
 	"unsafe"
 )
 
+// trampolineSize is the length of the jump written over a patched function.
+const trampolineSize = 12
+
 var ErrTypeUnsupported = errors.New("type unsupported")
 
 type (
@@ -15,6 +19,16 @@ type (
 		to       uintptr
 		original []byte
 		patched  []byte
+
+		// unpatch and restore replace the code copy for guards over data.
+		unpatch func()
+		restore func()
+
+		// trigger decides the calls the patch fires on.
+		trigger *Trigger
+
+		mu       sync.Mutex
+		released bool
 	}
 
 	value struct {
@@ -66,11 +80,51 @@ func Patch(target, replacement interface{}) *Guard {
 	return &Guard{from: from, to: to, original: original, patched: code}
 }
 
+// PatchValue writes val into target, keeping a copy of the previous value to
+// put back on Unpatch. Both writes go through reflect, so the collector sees
+// any pointer they carry.
+func PatchValue(target, val reflect.Value) *Guard {
+	old := reflect.New(target.Type()).Elem()
+	old.Set(target)
+	target.Set(val)
+
+	return &Guard{
+		from:    target.UnsafeAddr(),
+		unpatch: func() { target.Set(old) },
+		restore: func() { target.Set(val) },
+	}
+}
+
 func (g *Guard) Unpatch() {
+	if g.unpatch != nil {
+		g.unpatch()
+		return
+	}
 	CopyToLocation(g.from, g.original)
 }
 
+// Release unpatches for good: a hijacked call passing through to the original
+// does not patch it again on its way out.
+func (g *Guard) Release() {
+	g.mu.Lock()
+	g.released = true
+	g.mu.Unlock()
+	if g.trigger != nil {
+		g.trigger.stop()
+	}
+	g.Unpatch()
+}
+
 func (g *Guard) Restore() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.released {
+		return
+	}
+	if g.restore != nil {
+		g.restore()
+		return
+	}
 	CopyToLocation(g.from, g.patched)
 }
 
@@ -0,0 +1,289 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+type (
+	// pathStep is one step of a field path: a field name, or the map key or
+	// index written in brackets.
+	pathStep struct {
+		name    string
+		bracket bool
+	}
+
+	// fieldPath is a field path compiled against the type it starts from.
+	fieldPath struct {
+		elems []pathElem
+		typ   reflect.Type
+	}
+
+	pathElem struct {
+		field int
+		key   reflect.Value
+		index int
+	}
+)
+
+var ErrBadPath = fmt.Errorf("%w: bad path", ErrUnsupportAction)
+
+// parsePath splits a path such as `Header["X-Tenant"]` or `.Items[0].Name`
+// into its steps.
+func parsePath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	for i := 0; i < len(path); {
+		switch {
+		case path[i] == '[':
+			j := i + 1
+			if j < len(path) && path[j] == '"' {
+				for j++; j < len(path) && path[j] != '"'; j++ {
+					if path[j] == '\\' {
+						j++
+					}
+				}
+				j++
+			} else {
+				for j < len(path) && path[j] != ']' {
+					j++
+				}
+			}
+			if j >= len(path) || path[j] != ']' || j == i+1 {
+				return nil, fmt.Errorf("%w: %s", ErrBadPath, path)
+			}
+			key := path[i+1 : j]
+			if key[0] == '"' {
+				var err error
+				if key, err = strconv.Unquote(key); err != nil {
+					return nil, fmt.Errorf("%w: %s", ErrBadPath, path)
+				}
+			}
+			steps = append(steps, pathStep{name: key, bracket: true})
+			i = j + 1
+
+		case path[i] == '.' || i == 0:
+			if path[i] == '.' {
+				i++
+			}
+			j := i
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("%w: %s", ErrBadPath, path)
+			}
+			steps = append(steps, pathStep{name: path[i:j]})
+			i = j
+
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrBadPath, path)
+		}
+	}
+	return steps, nil
+}
+
+// splitPath splits `cfg.Timeout` into the name `cfg` and the path `.Timeout`.
+func splitPath(s string) (string, string) {
+	if i := strings.IndexAny(s, ".["); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// joinPath appends path to the path split off a name.
+func joinPath(prefix, path string) string {
+	if path == "" || prefix == "" || path[0] == '.' || path[0] == '[' {
+		return prefix + path
+	}
+	return prefix + "." + path
+}
+
+// compilePath resolves path against typ, following pointers implicitly. The
+// compiled path knows the type of the value it leads to.
+func compilePath(typ reflect.Type, path string) (*fieldPath, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &fieldPath{typ: typ}
+	for _, step := range steps {
+		t := p.typ
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+			if holdsLock(t) {
+				return nil, fmt.Errorf("%w: %s holds a lock and cannot be copied", ErrBadPath, t)
+			}
+		}
+
+		var elem pathElem
+		switch k := t.Kind(); {
+		case k == reflect.Struct && !step.bracket:
+			i := dwarfField(t, step.name)
+			if f, ok := t.FieldByName(step.name); i < 0 && ok && len(f.Index) == 1 {
+				i = f.Index[0]
+			} else if i < 0 {
+				i = fieldIndex(t, step.name)
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("%w: no field %s in %s", ErrBadPath, step.name, t)
+			}
+			elem.field, p.typ = i, t.Field(i).Type
+
+		case k == reflect.Map && step.bracket:
+			elem.key = reflect.New(t.Key()).Elem()
+			if err := decodeKey(elem.key, step.name); err != nil {
+				return nil, fmt.Errorf("%w: key %s of %s", ErrBadPath, step.name, t)
+			}
+			p.typ = t.Elem()
+
+		case (k == reflect.Slice || k == reflect.Array) && step.bracket:
+			n, err := strconv.Atoi(step.name)
+			if err != nil || n < 0 || (k == reflect.Array && n >= t.Len()) {
+				return nil, fmt.Errorf("%w: index %s of %s", ErrBadPath, step.name, t)
+			}
+			elem.index, p.typ = n, t.Elem()
+
+		default:
+			return nil, fmt.Errorf("%w: %s in %s", ErrBadPath, step.name, t)
+		}
+		p.elems = append(p.elems, elem)
+	}
+	return p, nil
+}
+
+// set returns v with the value at the path replaced by val. Everything along
+// the path is copied, pointees included, as http.Request.WithContext would, so
+// that the caller's own values are left alone. A slice index out of range
+// leaves v as it is.
+//
+// The copy of a pointee is a value of its own, so compilePath refuses to
+// follow pointers to locks, and Set to follow pointer receivers, whose
+// identity the callee depends on.
+func (p *fieldPath) set(v, val reflect.Value) reflect.Value {
+	return setPath(v, p.elems, val)
+}
+
+func setPath(v reflect.Value, elems []pathElem, val reflect.Value) reflect.Value {
+	if len(elems) == 0 {
+		return val
+	}
+	elem := elems[0]
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		c := reflect.New(v.Type().Elem())
+		if !v.IsNil() {
+			c.Elem().Set(v.Elem())
+		}
+		c.Elem().Set(setPath(c.Elem(), elems, val))
+		return c
+
+	case reflect.Struct:
+		c := copyOf(v)
+		f := c.Field(elem.field)
+		if !f.CanSet() {
+			f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+		}
+		f.Set(setPath(f, elems[1:], val))
+		return c
+
+	case reflect.Array:
+		c := copyOf(v)
+		e := c.Index(elem.index)
+		e.Set(setPath(e, elems[1:], val))
+		return c
+
+	case reflect.Map:
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			c.SetMapIndex(it.Key(), it.Value())
+		}
+		e := v.MapIndex(elem.key)
+		if !e.IsValid() {
+			e = reflect.Zero(v.Type().Elem())
+		}
+		c.SetMapIndex(elem.key, setPath(e, elems[1:], val))
+		return c
+
+	case reflect.Slice:
+		if elem.index >= v.Len() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		e := c.Index(elem.index)
+		e.Set(setPath(e, elems[1:], val))
+		return c
+	}
+	return v
+}
+
+var lockerType = reflect.TypeOf((*sync.Locker)(nil)).Elem()
+
+// holdsLock reports whether copying a value of typ copies a lock, as go vet
+// has it: typ, or a struct or array it holds by value, has Lock and Unlock on
+// its pointer. Atomics and WaitGroups hold such a noCopy guard.
+func holdsLock(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Struct:
+		if reflect.PtrTo(typ).Implements(lockerType) {
+			return true
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			if holdsLock(typ.Field(i).Type) {
+				return true
+			}
+		}
+	case reflect.Array:
+		return typ.Len() > 0 && holdsLock(typ.Elem())
+	}
+	return false
+}
+
+func copyOf(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// paramIndex returns the position of the argument, or the result, called name
+// in the function node of type typ. An unnamed error result answers to "err".
+func (r *Runtime) paramIndex(node *godwarf.Tree, typ reflect.Type, name string, result bool) (int, error) {
+	params, err := r.types.formalParameters(node)
+	if err != nil {
+		return 0, err
+	}
+
+	var names []string
+	for _, p := range params {
+		if p.Return == result {
+			names = append(names, p.Name)
+		}
+	}
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+	if result && name == "err" {
+		for i := typ.NumOut() - 1; i >= 0; i-- {
+			if typ.Out(i) == errorType && i < len(names) && (names[i] == "" || strings.HasPrefix(names[i], "~")) {
+				return i, nil
+			}
+		}
+	}
+
+	kind := "argument"
+	if result {
+		kind = "result"
+	}
+	return 0, fmt.Errorf("%w: no %s %s in %s(%s)", ErrUnsupportAction, kind, name, node.Entry.Val(dwarf.AttrName), strings.Join(names, ", "))
+}
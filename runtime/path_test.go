@@ -0,0 +1,202 @@
+package runtime
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type test_request struct {
+	Header http.Header
+	Tags   []string
+}
+
+//go:noinline
+func test_for_path(req *test_request, cfg test_config) (tenant string, timeout time.Duration, err error) {
+	return req.Header.Get("X-Tenant"), cfg.Timeout, nil
+}
+
+//go:noinline
+func (req *test_request) test_tenant() string {
+	return req.Header.Get("X-Tenant")
+}
+
+//go:noinline
+func test_for_unnamed(n int) (int, error) {
+	return n, nil
+}
+
+var _, _, _ = test_for_path(&test_request{Header: http.Header{}}, test_config{})
+var _, _ = test_for_unnamed(0)
+var _ = (&test_request{Header: http.Header{}}).test_tenant()
+
+var _ = Describe("Test Path", func() {
+	var r *Runtime
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	It("should parse paths", func() {
+		steps, err := parsePath(`Header["X-Tenant"][0].Name`)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(steps).To(Equal([]pathStep{
+			{name: "Header"}, {name: "X-Tenant", bracket: true}, {name: "0", bracket: true}, {name: "Name"},
+		}))
+
+		steps, err = parsePath(`.Labels["a]\"b"]`)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(steps).To(Equal([]pathStep{{name: "Labels"}, {name: `a]"b`, bracket: true}}))
+
+		for _, path := range []string{`Header[`, `Header[]`, `a..b`, `a.`, `[0]x`, `["x]`} {
+			_, err := parsePath(path)
+			Expect(err).Should(MatchError(ErrBadPath), path)
+		}
+
+		Expect(joinPath(".Timeout", "")).To(Equal(".Timeout"))
+		Expect(joinPath("", "Timeout")).To(Equal("Timeout"))
+		Expect(joinPath(".Limits", "burst")).To(Equal(".Limits.burst"))
+		Expect(joinPath(".Labels", `["env"]`)).To(Equal(`.Labels["env"]`))
+	})
+
+	It("should compile paths against types", func() {
+		typ := reflect.TypeOf(test_config{})
+		for path, want := range map[string]reflect.Type{
+			"":            typ,
+			"timeout":     reflect.TypeOf(time.Duration(0)),
+			"Limits.rate": reflect.TypeOf(float32(0)),
+			`Ports[443]`:  reflect.TypeOf(false),
+			`Secret[1]`:   reflect.TypeOf(byte(0)),
+		} {
+			p, err := compilePath(typ, path)
+			Expect(err).ShouldNot(HaveOccurred(), path)
+			Expect(p.typ).To(Equal(want), path)
+		}
+
+		for _, path := range []string{"Nope", `Ports["x"]`, "Secret[-1]", "Name.Len", `Labels.env`, `Limits[0]`} {
+			_, err := compilePath(typ, path)
+			Expect(err).Should(MatchError(ErrBadPath), path)
+		}
+	})
+
+	It("should refuse to copy locks and pointer receivers", func() {
+		type counter struct {
+			N  int
+			mu sync.Mutex
+		}
+		type guarded struct {
+			Counters [1]counter
+			wg       sync.WaitGroup
+		}
+		_, err := compilePath(reflect.TypeOf(&counter{}), "N")
+		Expect(err).Should(MatchError(ErrBadPath))
+		_, err = compilePath(reflect.TypeOf(&guarded{}), "Counters[0].N")
+		Expect(err).Should(MatchError(ErrBadPath))
+		_, err = compilePath(reflect.TypeOf(counter{}), "N")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(pointerMethod("github.com/u2386/go-hijack/runtime.(*test_request).test_tenant")).To(BeTrue())
+		Expect(pointerMethod("github.com/u2386/go-hijack/runtime.(*test_request).test_tenant.func1")).To(BeFalse())
+		Expect(pointerMethod("time.Time.String")).To(BeFalse())
+		Expect(pointerMethod("github.com/u2386/go-hijack/runtime.test_for_path")).To(BeFalse())
+
+		name := "github.com/u2386/go-hijack/runtime.(*test_request).test_tenant"
+		_, err = (&patcher{}).Set(r, Request{"func": name, "arg": "req.Header", "val": fromJSON(`{}`)})
+		Expect(err).Should(MatchError(ErrBadPath))
+		Expect(err.Error()).To(ContainSubstring("copy of its receiver"))
+
+		g, err := (&patcher{}).Set(r, Request{"func": name, "arg": "req", "val": fromJSON(`{"Header": {"X-Tenant": ["acme"]}}`)})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+		Expect((&test_request{Header: http.Header{}}).test_tenant()).To(Equal("acme"))
+	})
+
+	It("should set values along paths without touching the caller's", func() {
+		c := test_config{Labels: map[string]string{"env": "prod"}, Secret: []byte("ab")}
+		set := func(v interface{}, path string, val interface{}) interface{} {
+			p, err := compilePath(reflect.TypeOf(v), path)
+			Expect(err).ShouldNot(HaveOccurred())
+			return p.set(reflect.ValueOf(v), reflect.ValueOf(val).Convert(p.typ)).Interface()
+		}
+
+		got := set(c, `Labels["env"]`, "dev").(test_config)
+		Expect(got.Labels).To(Equal(map[string]string{"env": "dev"}))
+		Expect(c.Labels).To(Equal(map[string]string{"env": "prod"}))
+
+		got = set(c, "Limits.rate", float32(0.5)).(test_config)
+		Expect(got.Limits).To(Equal(&test_limits{rate: 0.5}))
+		Expect(c.Limits).To(BeNil())
+
+		got = set(c, "Secret[1]", byte('z')).(test_config)
+		Expect(got.Secret).To(Equal([]byte("az")))
+		Expect(c.Secret).To(Equal([]byte("ab")))
+
+		got = set(c, "Secret[5]", byte('z')).(test_config)
+		Expect(got.Secret).To(Equal([]byte("ab")))
+
+		pc := &test_config{Name: "self"}
+		Expect(set(pc, "Name", "api")).To(Equal(&test_config{Name: "api"}))
+		Expect(pc.Name).To(Equal("self"))
+	})
+
+	It("should address arguments and results by name", func() {
+		const name = "github.com/u2386/go-hijack/runtime.test_for_path"
+		hijack := func(pat ActionFunc, m Request) *Guard {
+			m["func"] = name
+			g, err := pat(r, m)
+			Expect(err).ShouldNot(HaveOccurred())
+			return g
+		}
+		pat := &patcher{}
+
+		req := &test_request{Header: http.Header{"X-Tenant": {"self"}}}
+		cfg := test_config{Timeout: time.Second}
+
+		g := hijack(pat.Set, Request{"arg": "req", "path": `Header["X-Tenant"]`, "val": fromJSON(`["acme"]`)})
+		tenant, _, _ := test_for_path(req, cfg)
+		g.Unpatch()
+		Expect(tenant).To(Equal("acme"))
+		Expect(req.Header.Get("X-Tenant")).To(Equal("self"))
+
+		g = hijack(pat.Set, Request{"arg": "cfg.Timeout", "val": "2s"})
+		_, timeout, _ := test_for_path(req, cfg)
+		g.Unpatch()
+		Expect(timeout).To(Equal(2 * time.Second))
+		Expect(cfg.Timeout).To(Equal(time.Second))
+
+		g = hijack(pat.Return, Request{"result": "err", "val": "io.EOF"})
+		_, _, err := test_for_path(req, cfg)
+		g.Unpatch()
+		Expect(err).To(Equal(io.EOF))
+
+		g = hijack(pat.Return, Request{"result": "timeout", "val": "1m"})
+		_, timeout, _ = test_for_path(req, cfg)
+		g.Unpatch()
+		Expect(timeout).To(Equal(time.Minute))
+
+		_, err = pat.Set(r, Request{"func": name, "arg": "nope", "val": 1})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+		Expect(err.Error()).To(ContainSubstring("(req, cfg)"))
+
+		_, err = pat.Set(r, Request{"func": name, "arg": "cfg.Nope", "val": 1})
+		Expect(err).Should(MatchError(ErrBadPath))
+	})
+
+	It("should take an unnamed error result for err", func() {
+		g, err := (&patcher{}).Return(r, Request{
+			"func":   "github.com/u2386/go-hijack/runtime.test_for_unnamed",
+			"result": "err",
+			"val":    "io.EOF",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		_, err = test_for_unnamed(1)
+		Expect(err).To(Equal(io.EOF))
+	})
+})
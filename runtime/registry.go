@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+type (
+	TypeStats struct {
+		DwarfTypes int    `json:"dwarf_types"`
+		Types      int64  `json:"types"`
+		Funcs      int64  `json:"funcs"`
+		Hits       uint64 `json:"hits"`
+		Misses     uint64 `json:"misses"`
+	}
+
+	built struct {
+		typ reflect.Type
+		err error
+	}
+
+	// TypeRegistry reads the DWARF types of one binary and memoizes the
+	// reflect types built from them per DWARF offset. It is safe for
+	// concurrent use.
+	TypeRegistry struct {
+		dwarf *dwarf.Data
+
+		// module is the type section of the binary when it is the running
+		// one, and nil otherwise.
+		module *module
+
+		// mu guards dwarfTypes, which godwarf fills while reading.
+		mu         sync.Mutex
+		dwarfTypes map[dwarf.Offset]godwarf.Type
+
+		types, funcs sync.Map
+		ntypes       int64
+		nfuncs       int64
+		hits, misses uint64
+	}
+)
+
+func NewTypeRegistry(dw *dwarf.Data) *TypeRegistry {
+	return &TypeRegistry{
+		dwarf:      dw,
+		dwarfTypes: make(map[dwarf.Offset]godwarf.Type),
+	}
+}
+
+func (t *TypeRegistry) ReadType(off dwarf.Offset) (godwarf.Type, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return godwarf.ReadType(t.dwarf, 0, off, t.dwarfTypes)
+}
+
+func (t *TypeRegistry) nodeType(node *godwarf.Tree) (godwarf.Type, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return node.Type(t.dwarf, int(node.Offset), t.dwarfTypes)
+}
+
+func (t *TypeRegistry) memo(m *sync.Map, n *int64, off dwarf.Offset, build func() (reflect.Type, error)) (reflect.Type, error) {
+	if v, ok := m.Load(off); ok {
+		atomic.AddUint64(&t.hits, 1)
+		b := v.(built)
+		return b.typ, b.err
+	}
+	atomic.AddUint64(&t.misses, 1)
+
+	typ, err := build()
+	if _, loaded := m.LoadOrStore(off, built{typ, err}); !loaded {
+		atomic.AddInt64(n, 1)
+	}
+	return typ, err
+}
+
+// Type is MakeType, built once per DWARF type.
+func (t *TypeRegistry) Type(typ godwarf.Type) (reflect.Type, error) {
+	return t.memo(&t.types, &t.ntypes, typ.Common().Offset, func() (reflect.Type, error) {
+		return t.makeType(typ)
+	})
+}
+
+func (t *TypeRegistry) formalParameters(tree *godwarf.Tree) ([]formalParameter, error) {
+	var params []formalParameter
+	for _, node := range tree.Children {
+		if node.Tag != dwarf.TagFormalParameter {
+			continue
+		}
+
+		typ, err := t.nodeType(node)
+		if err != nil {
+			return nil, err
+		}
+
+		name, _ := node.Entry.Val(dwarf.AttrName).(string)
+		ret, _ := node.Entry.Val(dwarf.AttrVarParam).(bool)
+		params = append(params, formalParameter{Name: name, Type: typ, Return: ret})
+	}
+	return params, nil
+}
+
+// FuncSignature renders the declaration of a function from its DWARF.
+func (t *TypeRegistry) FuncSignature(tree *godwarf.Tree) (string, error) {
+	params, err := t.formalParameters(tree)
+	if err != nil {
+		return "", err
+	}
+	return signatureOf(tree, params), nil
+}
+
+// Func is MakeFunc, built once per function.
+func (t *TypeRegistry) Func(tree *godwarf.Tree) (reflect.Type, error) {
+	return t.memo(&t.funcs, &t.nfuncs, tree.Offset, func() (reflect.Type, error) {
+		params, err := t.formalParameters(tree)
+		if err != nil {
+			return nil, err
+		}
+
+		var in, out []reflect.Type
+		for _, p := range params {
+			param, err := t.Type(p.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			if p.Return {
+				out = append(out, param)
+			} else {
+				in = append(in, param)
+			}
+		}
+		debug("%s", signatureOf(tree, params))
+
+		return reflect.FuncOf(in, out, false), nil
+	})
+}
+
+func (t *TypeRegistry) Stats() TypeStats {
+	t.mu.Lock()
+	n := len(t.dwarfTypes)
+	t.mu.Unlock()
+
+	return TypeStats{
+		DwarfTypes: n,
+		Types:      atomic.LoadInt64(&t.ntypes),
+		Funcs:      atomic.LoadInt64(&t.nfuncs),
+		Hits:       atomic.LoadUint64(&t.hits),
+		Misses:     atomic.LoadUint64(&t.misses),
+	}
+}
@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"sync"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Type Registry", func() {
+	var r *Runtime
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	It("should memoize functions", func() {
+		tree := r.dwarftrees["github.com/u2386/go-hijack/runtime.test_for_two_returns"]
+		ft, err := r.types.Func(tree)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		stats := r.TypeStats()
+		Expect(stats.Funcs).To(BeEquivalentTo(1))
+		Expect(stats.Types).To(BeEquivalentTo(3))
+		Expect(stats.DwarfTypes).ShouldNot(BeZero())
+
+		again, err := r.types.Func(tree)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(again).To(Equal(ft))
+		Expect(r.TypeStats().Funcs).To(Equal(stats.Funcs))
+		Expect(r.TypeStats().Hits).To(Equal(stats.Hits + 1))
+	})
+
+	It("should memoize errors", func() {
+		var (
+			tree *godwarf.Tree
+			err  error
+		)
+		for _, tree = range r.dwarftrees {
+			if _, err = r.types.Func(tree); err != nil {
+				break
+			}
+		}
+		Expect(err).Should(MatchError(ErrUnsupportedType))
+
+		misses := r.TypeStats().Misses
+		_, again := r.types.Func(tree)
+		Expect(again).To(Equal(err))
+		Expect(r.TypeStats().Misses).To(Equal(misses))
+	})
+
+	It("should be safe for concurrent use", func() {
+		var trees []*godwarf.Tree
+		for _, tree := range r.dwarftrees {
+			if trees = append(trees, tree); len(trees) == 500 {
+				break
+			}
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for _, tree := range trees {
+					r.types.Func(tree)
+				}
+			}()
+		}
+		wg.Wait()
+
+		stats := r.TypeStats()
+		Expect(stats.Funcs).To(BeEquivalentTo(len(trees)))
+		Expect(stats.Hits + stats.Misses).To(BeNumerically(">=", 8*len(trees)))
+	})
+})
@@ -9,6 +9,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,9 +21,31 @@ import (
 type (
 	Request map[string]interface{}
 
+	// HijackPoint names the function to hijack and the action to take. The
+	// point fires on a Probability of the calls, all of them when unset, drawn
+	// from Seed when one is given so that a run can be replayed. Calls that
+	// do not fire go straight to the function, see Trigger.
+	//
+	// Counting calls from 1, the point may also fire on the First calls only,
+	// on those After a number, those Between two numbers included, or on
+	// Every nth one of them. It is released after the last call its window
+	// allows.
+	//
+	// A point fires from StartAt, and is released at EndAt or once its TTL
+	// elapsed. StartAt and EndAt are RFC 3339 times, TTL a duration such as
+	// "10m".
 	HijackPoint struct {
-		Func   string
-		Action Action
+		Func        string
+		Action      Action
+		Probability *float64
+		Seed        *int64
+		First       uint64
+		After       uint64
+		Between     []uint64
+		Every       uint64
+		TTL         string
+		StartAt     string `mapstructure:"start_at"`
+		EndAt       string `mapstructure:"end_at"`
 	}
 
 	DelayPoint struct {
@@ -35,25 +58,58 @@ type (
 		Val         string
 	}
 
+	// SetPoint replaces the argument at Index, or the one named Arg, or only
+	// its element Elem when the argument is variadic. A Path such as
+	// `Header["X-Tenant"]` narrows the replacement to a field, key or index
+	// within it; Arg may carry the path itself, as in `cfg.Timeout`.
+	//
+	// Variadic parameters are told from slices by the source of the function,
+	// or by Variadic where the source is not at hand.
 	SetPoint struct {
 		HijackPoint `mapstructure:",squash"`
 		Index       int
+		Arg         string
+		Elem        *int
+		Variadic    bool
+		Path        string
 		Val         interface{}
 	}
 
+	// ReturnPoint replaces the result at Index, or the one named Result, or a
+	// Path within it as for SetPoint.
 	ReturnPoint struct {
 		HijackPoint `mapstructure:",squash"`
 		Index       int
+		Result      string
+		Path        string
+		Val         interface{}
+	}
+
+	// VarPoint names a package-level variable in Func.
+	VarPoint struct {
+		HijackPoint `mapstructure:",squash"`
 		Val         interface{}
 	}
 
 	Runtime struct {
 		M          sync.Map
 		C          chan func()
+		mu         sync.Mutex // orders the points stored in and deleted from M
 		patches    map[Action]ActionFunc
 		dwarftrees map[string]*godwarf.Tree
 		symbols    map[string]elf.Symbol
 		dwarf      *dwarf.Data
+		types      *TypeRegistry
+		toolchain  *Toolchain
+
+		declOnce  sync.Once
+		declFiles map[dwarf.Offset]string
+		rangeOnce sync.Once
+		ranges    []funcRange
+		varOnce   sync.Once
+		variables map[string]*dwarf.Entry
+		symOnce   sync.Once
+		sorted    []elf.Symbol
 	}
 
 	patcher struct{}
@@ -67,6 +123,7 @@ const (
 	PANIC  Action = "panic"
 	SET    Action = "set"
 	RETURN Action = "return"
+	SETVAR Action = "setvar"
 )
 
 var (
@@ -74,6 +131,7 @@ var (
 	ErrUnsupportAction = errors.New("unsupport action")
 	ErrPointNotFound   = errors.New("function point not found")
 	ErrPatchedAlready  = errors.New("patched already")
+	ErrUnsupportedSort = errors.New("unsupported sort")
 )
 
 func debug(format string, args ...interface{}) {
@@ -94,6 +152,7 @@ func New(pid int) (*Runtime, error) {
 		PANIC:  pat.Panic,
 		SET:    pat.Set,
 		RETURN: pat.Return,
+		SETVAR: pat.SetVar,
 	}
 
 	ef, err := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
@@ -108,10 +167,16 @@ func New(pid int) (*Runtime, error) {
 	for _, sym := range syms {
 		r.symbols[sym.Name] = sym
 	}
+	r.toolchain = ReadToolchain(pid, ef, r.symbols)
+	debug("built by %s with DWARF %d", r.toolchain.GoVersion, r.toolchain.DWARFVersion)
 
 	r.dwarf, err = ef.DWARF()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %s", ErrNoDwarf, err)
+	}
+	r.types = NewTypeRegistry(r.dwarf)
+	if pid == os.Getpid() {
+		r.types.module = selfModule(r.symbols)
 	}
 	r.dwarftrees, err = DwarfTree(r.dwarf)
 	if err != nil {
@@ -137,11 +202,22 @@ func (r *Runtime) Run(ctx context.Context) {
 	}()
 }
 
+func (r *Runtime) Toolchain() *Toolchain {
+	return r.toolchain
+}
+
+func (r *Runtime) TypeStats() TypeStats {
+	return r.types.Stats()
+}
+
 func (r *Runtime) Funcs() []string {
 	var ns []string
-	for sym := range r.symbols {
-		ns = append(ns, sym)
+	for name, sym := range r.symbols {
+		if isFunc(sym) {
+			ns = append(ns, name)
+		}
 	}
+	sort.Strings(ns)
 	return ns
 }
 
@@ -154,29 +230,91 @@ func (r *Runtime) Points() []string {
 	return ns
 }
 
+// PointStats describes the live hijack points, sorted by function.
+func (r *Runtime) PointStats() []PointStat {
+	stats := []PointStat{}
+	r.M.Range(func(key, value interface{}) bool {
+		if g := value.(*Guard); g != nil && g.trigger != nil {
+			stats = append(stats, g.trigger.Stat())
+		} else {
+			stats = append(stats, PointStat{Func: key.(string)})
+		}
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Func < stats[j].Func })
+	return stats
+}
+
+// Release releases the point on fn, which may be named as it was hijacked: by
+// a short name or a source position as well as by its symbol.
 func (r *Runtime) Release(fn string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.release(fn) {
+		return
+	}
+	if name, err := r.Resolve(fn); err == nil {
+		r.release(name)
+	}
+}
+
+func (r *Runtime) release(fn string) (found bool) {
 	r.M.Range(func(key, value interface{}) bool {
 		if strings.EqualFold(fn, key.(string)) {
-			value.(*Guard).Unpatch()
+			if g := value.(*Guard); g != nil {
+				g.Release()
+			} else {
+				g.Unpatch()
+			}
 			r.M.Delete(key)
+			found = true
 			return false
 		}
 		return true
 	})
+	return
 }
 
 func (r *Runtime) Hijack(m Request) error {
 	var point HijackPoint
-	mapstructure.Decode(m, &point)
+	if err := mapstructure.Decode(m, &point); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnsupportAction, err)
+	}
 	if patch, ok := r.patches[point.Action]; ok {
-		if _, ok := r.M.Load(point.Func); ok {
-			return ErrPatchedAlready
+		if err := r.toolchain.Check(point.Action); err != nil {
+			return err
+		}
+		if point.Func != "" && point.Action != SETVAR {
+			name, err := r.Resolve(point.Func)
+			if err != nil {
+				return err
+			}
+			// Replace the key the caller sent, which mapstructure matched
+			// regardless of case, rather than add another.
+			for k := range m {
+				if strings.EqualFold(k, "func") {
+					delete(m, k)
+				}
+			}
+			m["func"], point.Func = name, name
 		}
 
 		c := make(chan error, 1)
 		r.C <- func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if _, ok := r.M.Load(point.Func); ok {
+				c <- ErrPatchedAlready
+				return
+			}
 			if g, err := patch(r, m); err == nil {
 				r.M.Store(point.Func, g)
+				if g != nil && g.trigger != nil {
+					// The last call of a window exhausts the point from
+					// within the hijacked goroutine, which must not wait
+					// for the patch to be written back.
+					g.trigger.whenExhausted(func() { go r.expire(point.Func, g) })
+				}
 				c <- nil
 			} else {
 				c <- err
@@ -187,88 +325,152 @@ func (r *Runtime) Hijack(m Request) error {
 	return ErrUnsupportAction
 }
 
+// expire releases the point on fn if g still guards it, and not a point
+// hijacked again since g was released.
+func (r *Runtime) expire(fn string, g *Guard) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.M.Load(fn); ok && v == g {
+		g.Release()
+		r.M.Delete(fn)
+	}
+}
+
+func (r *Runtime) target(name string) (*godwarf.Tree, elf.Symbol, error) {
+	node, ok := r.dwarftrees[name]
+	if !ok {
+		return nil, elf.Symbol{}, &NotFoundError{Func: name, Suggestions: r.suggest(name)}
+	}
+	symbol, ok := r.symbols[name]
+	if !ok {
+		return nil, elf.Symbol{}, fmt.Errorf("%w: %s is %s", ErrPointNotFound, name, r.Check(name).Reason)
+	}
+	return node, symbol, nil
+}
+
 func (*patcher) Delay(r *Runtime, m Request) (*Guard, error) {
 	var point DelayPoint
-	mapstructure.Decode(m, &point)
+	if err := mapstructure.Decode(m, &point); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportAction, err)
+	}
 
-	var ok bool
 	if point.Val <= 0 {
 		return nil, ErrUnsupportAction
 	}
 
-	var (
-		node   *godwarf.Tree
-		symbol elf.Symbol
-		guard  *Guard
-	)
-	if node, ok = r.dwarftrees[point.Func]; !ok {
-		return nil, ErrPointNotFound
+	t, err := point.trigger()
+	if err != nil {
+		return nil, err
 	}
-	if symbol, ok = r.symbols[point.Func]; !ok {
-		return nil, ErrPointNotFound
+	node, symbol, err := r.target(point.Func)
+	if err != nil {
+		return nil, err
 	}
 
-	typ, err := MakeFunc(node, r.dwarf)
+	typ, err := r.makeFunc(node)
 	if err != nil {
 		return nil, err
 	}
 
+	var guard *Guard
 	stub := reflect.MakeFunc(typ, nil)
 	replacement := reflect.MakeFunc(typ, func(args []reflect.Value) (results []reflect.Value) {
-		time.Sleep(time.Millisecond * time.Duration(point.Val))
-		guard.Unpatch()
-		defer guard.Restore()
-
-		g := Patch(stub.Pointer(), symbol.Value)
-		defer g.Unpatch()
-		return stub.Call(args)
+		if t.Fire() {
+			time.Sleep(time.Millisecond * time.Duration(point.Val))
+		}
+		return passthrough(guard, stub, symbol.Value, args)
 	})
 
-	guard = Patch(symbol.Value, replacement.Interface())
+	guard = patchTriggered(symbol.Value, replacement, t)
 	return guard, nil
 }
 
 func (*patcher) Panic(r *Runtime, m Request) (*Guard, error) {
 	var point PanicPoint
-	mapstructure.Decode(m, &point)
+	if err := mapstructure.Decode(m, &point); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportAction, err)
+	}
 
-	node, ok := r.dwarftrees[point.Func]
-	if !ok {
-		return nil, ErrPointNotFound
+	t, err := point.trigger()
+	if err != nil {
+		return nil, err
 	}
-	symbol, ok := r.symbols[point.Func]
-	if !ok {
-		return nil, ErrPointNotFound
+	node, symbol, err := r.target(point.Func)
+	if err != nil {
+		return nil, err
 	}
 
-	typ, err := MakeFunc(node, r.dwarf)
+	typ, err := r.makeFunc(node)
 	if err != nil {
 		return nil, err
 	}
 
 	var guard *Guard
+	stub := reflect.MakeFunc(typ, nil)
 	replacement := reflect.MakeFunc(typ, func(args []reflect.Value) (results []reflect.Value) {
-		panic(fmt.Sprintf("hijack:%s", point.Val))
+		if t.Fire() {
+			panic(fmt.Sprintf("hijack:%s", point.Val))
+		}
+		return passthrough(guard, stub, symbol.Value, args)
 	})
 
-	guard = Patch(symbol.Value, replacement.Interface())
+	guard = patchTriggered(symbol.Value, replacement, t)
 	return guard, nil
 }
 
 func (*patcher) Set(r *Runtime, m Request) (*Guard, error) {
 	var point SetPoint
-	mapstructure.Decode(m, &point)
+	if err := mapstructure.Decode(m, &point); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportAction, err)
+	}
 
-	node, ok := r.dwarftrees[point.Func]
-	if !ok {
-		return nil, ErrPointNotFound
+	t, err := point.trigger()
+	if err != nil {
+		return nil, err
 	}
-	symbol, ok := r.symbols[point.Func]
-	if !ok {
-		return nil, ErrPointNotFound
+	node, symbol, err := r.target(point.Func)
+	if err != nil {
+		return nil, err
 	}
 
-	typ, err := MakeFunc(node, r.dwarf)
+	typ, err := r.makeFunc(node)
+	if err != nil {
+		return nil, err
+	}
+	if point.Variadic {
+		if typ, err = asVariadic(typ); err != nil {
+			return nil, err
+		}
+	}
+
+	if point.Arg != "" {
+		var path string
+		point.Arg, path = splitPath(point.Arg)
+		point.Path = joinPath(path, point.Path)
+		if point.Index, err = r.paramIndex(node, typ, point.Arg, false); err != nil {
+			return nil, err
+		}
+	}
+	if point.Index < 0 || point.Index >= typ.NumIn() {
+		return nil, fmt.Errorf("%w: no argument %d in %s", ErrUnsupportAction, point.Index, typ)
+	}
+	target := typ.In(point.Index)
+	if point.Elem != nil {
+		if !typ.IsVariadic() || point.Index != typ.NumIn()-1 || *point.Elem < 0 {
+			return nil, fmt.Errorf("%w: argument %d of %s is not variadic", ErrUnsupportAction, point.Index, typ)
+		}
+		target = target.Elem()
+	}
+	path, err := compilePath(target, point.Path)
+	if err != nil {
+		return nil, err
+	}
+	if point.Index == 0 && len(path.elems) > 0 && target.Kind() == reflect.Ptr && pointerMethod(point.Func) {
+		return nil, fmt.Errorf("%w: %s would run on a copy of its receiver", ErrBadPath, point.Func)
+	}
+	// Decode before patching, so that a mismatch is refused up front instead
+	// of panicking in the hijacked goroutine.
+	val, err := r.decode(path.typ, point.Val)
 	if err != nil {
 		return nil, err
 	}
@@ -276,35 +478,65 @@ func (*patcher) Set(r *Runtime, m Request) (*Guard, error) {
 	var guard *Guard
 	stub := reflect.MakeFunc(typ, nil)
 	replacement := reflect.MakeFunc(typ, func(args []reflect.Value) (results []reflect.Value) {
-		args[point.Index] = reflect.ValueOf(point.Val)
-
-		guard.Unpatch()
-		defer guard.Restore()
-
-		g := Patch(stub.Pointer(), symbol.Value)
-		defer g.Unpatch()
-
-		return stub.Call(args)
+		if !t.Fire() {
+			return passthrough(guard, stub, symbol.Value, args)
+		}
+		// Every call gets a value of its own, as calls may keep or change
+		// the maps, slices and pointees in it.
+		val := clone(val)
+		if point.Elem == nil {
+			args[point.Index] = path.set(args[point.Index], val)
+		} else if s := args[point.Index]; *point.Elem < s.Len() {
+			// Copy the variadic slice, which may be the caller's own.
+			elems := reflect.MakeSlice(s.Type(), s.Len(), s.Len())
+			reflect.Copy(elems, s)
+			e := elems.Index(*point.Elem)
+			e.Set(path.set(e, val))
+			args[point.Index] = elems
+		}
+		return passthrough(guard, stub, symbol.Value, args)
 	})
 
-	guard = Patch(symbol.Value, replacement.Interface())
+	guard = patchTriggered(symbol.Value, replacement, t)
 	return guard, nil
 }
 
 func (*patcher) Return(r *Runtime, m Request) (*Guard, error) {
-	var point SetPoint
-	mapstructure.Decode(m, &point)
+	var point ReturnPoint
+	if err := mapstructure.Decode(m, &point); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportAction, err)
+	}
 
-	node, ok := r.dwarftrees[point.Func]
-	if !ok {
-		return nil, ErrPointNotFound
+	t, err := point.trigger()
+	if err != nil {
+		return nil, err
 	}
-	symbol, ok := r.symbols[point.Func]
-	if !ok {
-		return nil, ErrPointNotFound
+	node, symbol, err := r.target(point.Func)
+	if err != nil {
+		return nil, err
 	}
 
-	typ, err := MakeFunc(node, r.dwarf)
+	typ, err := r.makeFunc(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if point.Result != "" {
+		var path string
+		point.Result, path = splitPath(point.Result)
+		point.Path = joinPath(path, point.Path)
+		if point.Index, err = r.paramIndex(node, typ, point.Result, true); err != nil {
+			return nil, err
+		}
+	}
+	if point.Index < 0 || point.Index >= typ.NumOut() {
+		return nil, fmt.Errorf("%w: no result %d in %s", ErrUnsupportAction, point.Index, typ)
+	}
+	path, err := compilePath(typ.Out(point.Index), point.Path)
+	if err != nil {
+		return nil, err
+	}
+	val, err := r.decode(path.typ, point.Val)
 	if err != nil {
 		return nil, err
 	}
@@ -312,23 +544,40 @@ func (*patcher) Return(r *Runtime, m Request) (*Guard, error) {
 	var guard *Guard
 	stub := reflect.MakeFunc(typ, nil)
 	replacement := reflect.MakeFunc(typ, func(args []reflect.Value) (results []reflect.Value) {
-		guard.Unpatch()
-		defer guard.Restore()
-
-		g := Patch(stub.Pointer(), symbol.Value)
-		defer g.Unpatch()
-
-		results = stub.Call(args)
-		if point.Index < typ.NumOut() {
-			if typ.Out(point.Index).Kind() == reflect.TypeOf((*error)(nil)).Elem().Kind() {
-				results[point.Index] = reflect.ValueOf(errors.New(point.Val.(string)))
-				return
-			}
-			results[point.Index] = reflect.ValueOf(point.Val)
+		fire := t.Fire()
+		results = passthrough(guard, stub, symbol.Value, args)
+		if fire {
+			results[point.Index] = path.set(results[point.Index], clone(val))
 		}
 		return
 	})
 
-	guard = Patch(symbol.Value, replacement.Interface())
+	guard = patchTriggered(symbol.Value, replacement, t)
 	return guard, nil
 }
+
+// patchTriggered patches replacement over the function at addr. When the
+// instructions the patch overwrites can be moved, a gate stands in front of
+// replacement and passes the calls t knows not to fire to the original.
+func patchTriggered(addr uint64, replacement reflect.Value, t *Trigger) *Guard {
+	var guard *Guard
+	if g := newGate(uintptr(addr), replacement); g != nil {
+		t.gated(g)
+		guard = Patch(addr, g)
+	} else {
+		guard = Patch(addr, replacement.Interface())
+	}
+	guard.trigger = t
+	return guard
+}
+
+// passthrough calls the original function at addr from within the replacement
+// patched over it by guard, through a stub of the same type.
+func passthrough(guard *Guard, stub reflect.Value, addr uint64, args []reflect.Value) []reflect.Value {
+	guard.Unpatch()
+	defer guard.Restore()
+
+	g := Patch(stub.Pointer(), addr)
+	defer g.Unpatch()
+	return call(stub, args)
+}
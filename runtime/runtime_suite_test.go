@@ -323,14 +323,10 @@ var _ = Describe("Test Make Func", func() {
 		)
 
 		BeforeEach(func() {
-			pid := os.Getpid()
-			ef, _ := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
-			dw, _ := ef.DWARF()
-			trees, _ := DwarfTree(dw)
-
-			for name, tree := range trees {
+			r, _ := New(pid)
+			for name, tree := range r.dwarftrees {
 				if strings.HasSuffix(name, "test_for_interface_arg") {
-					ft, err = MakeFunc(tree, dw)
+					ft, err = r.types.Func(tree)
 					break
 				}
 			}
@@ -342,7 +338,7 @@ var _ = Describe("Test Make Func", func() {
 
 			fn := reflect.MakeFunc(ft, func(args []reflect.Value) (results []reflect.Value) {
 				return []reflect.Value{reflect.ValueOf("1024")}
-			}).Interface().(func(interface{}) string)
+			}).Interface().(func(test_iface) string)
 			Expect(fn(&test_iface_impl{})).Should(BeEquivalentTo("1024"))
 		})
 	})
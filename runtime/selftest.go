@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"errors"
+	"sort"
+	"strings"
+)
+
+type (
+	Patchability struct {
+		Func      string `json:"func"`
+		Patchable bool   `json:"patchable"`
+		Reason    string `json:"reason,omitempty"`
+		Detail    string `json:"detail,omitempty"`
+	}
+
+	PackageReport struct {
+		Package   string         `json:"package"`
+		Total     int            `json:"total"`
+		Patchable int            `json:"patchable"`
+		Funcs     []Patchability `json:"funcs"`
+	}
+
+	SelfTestReport struct {
+		Total     int             `json:"total"`
+		Patchable int             `json:"patchable"`
+		Reasons   map[string]int  `json:"reasons"`
+		Packages  []PackageReport `json:"packages"`
+	}
+)
+
+const (
+	ReasonNoDwarf         = "no dwarf"
+	ReasonNoCode          = "no code"
+	ReasonInlined         = "inlined everywhere"
+	ReasonTooShort        = "too short"
+	ReasonUnsupportedType = "unsupported type"
+	ReasonUnreadableType  = "unreadable type"
+	ReasonABIWrapper      = "abi wrapper"
+	ReasonRuntimeInternal = "runtime internal"
+)
+
+// isRuntimeInternal reports whether patching a package would break the
+// machinery hooks rely on: the scheduler, memory allocator and reflection.
+func isRuntimeInternal(pkg string) bool {
+	switch {
+	case pkg == "runtime", pkg == "reflect", pkg == "unsafe":
+		return true
+	case strings.HasPrefix(pkg, "runtime/internal/"), strings.HasPrefix(pkg, "internal/runtime/"):
+		return true
+	case strings.HasPrefix(pkg, "internal/abi"), strings.HasPrefix(pkg, "internal/reflectlite"):
+		return true
+	}
+	return false
+}
+
+func (r *Runtime) isWrapper(name string, off dwarf.Offset) bool {
+	if strings.HasSuffix(name, ".abi0") || strings.HasSuffix(name, ".abiinternal") {
+		return true
+	}
+	return r.declFile(off) == "<autogenerated>"
+}
+
+// Check tells whether a function can be hijacked, and why not if it cannot.
+func (r *Runtime) Check(name string) Patchability {
+	p := Patchability{Func: name}
+
+	node, ok := r.dwarftrees[name]
+	if !ok {
+		p.Reason = ReasonNoDwarf
+		return p
+	}
+	if isRuntimeInternal(FuncPackage(name)) {
+		p.Reason = ReasonRuntimeInternal
+		return p
+	}
+	if r.isWrapper(name, node.Offset) {
+		p.Reason = ReasonABIWrapper
+		return p
+	}
+
+	_, inlined := node.Entry.Val(dwarf.AttrInline).(int64)
+	sym, ok := r.symbols[name]
+	if !ok {
+		if p.Reason = ReasonNoCode; inlined {
+			p.Reason = ReasonInlined
+		}
+		return p
+	}
+	if sym.Size < trampolineSize {
+		p.Reason = ReasonTooShort
+		return p
+	}
+
+	if _, err := r.types.Func(node); err != nil {
+		if p.Reason = ReasonUnsupportedType; !errors.Is(err, ErrUnsupportedType) {
+			p.Reason = ReasonUnreadableType
+		}
+		p.Detail = err.Error()
+		return p
+	}
+
+	p.Patchable = true
+	if inlined {
+		p.Detail = "inlined at some call sites"
+	}
+	return p
+}
+
+// SelfTest checks every Go function known from DWARF, optionally limited to
+// one package, and groups the result by package.
+func (r *Runtime) SelfTest(pkg string) *SelfTestReport {
+	var names []string
+	for name := range r.dwarftrees {
+		if pkg == "" || FuncPackage(name) == pkg {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pi, pj := FuncPackage(names[i]), FuncPackage(names[j]); pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+
+	report := &SelfTestReport{Reasons: make(map[string]int), Packages: []PackageReport{}}
+	for _, name := range names {
+		p := r.Check(name)
+
+		pkg := FuncPackage(name)
+		if n := len(report.Packages); n == 0 || report.Packages[n-1].Package != pkg {
+			report.Packages = append(report.Packages, PackageReport{Package: pkg})
+		}
+		pr := &report.Packages[len(report.Packages)-1]
+
+		pr.Total++
+		report.Total++
+		if p.Patchable {
+			pr.Patchable++
+			report.Patchable++
+		} else {
+			report.Reasons[p.Reason]++
+		}
+		pr.Funcs = append(pr.Funcs, p)
+	}
+	return report
+}
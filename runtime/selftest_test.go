@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:noinline
+func test_for_too_short() {}
+
+var _ = Describe("Test Self Test", func() {
+	var (
+		r *Runtime
+	)
+
+	BeforeEach(func() {
+		test_for_too_short()
+		r, _ = New(pid)
+	})
+
+	It("should check functions", func() {
+		Expect(r.Check("github.com/u2386/go-hijack/runtime.this_is_for_test").Patchable).Should(BeTrue())
+		Expect(r.Check("github.com/u2386/go-hijack/runtime.test_for_too_short").Reason).To(Equal(ReasonTooShort))
+		Expect(r.Check("runtime.mallocgc").Reason).To(Equal(ReasonRuntimeInternal))
+		Expect(r.Check("unknown").Reason).To(Equal(ReasonNoDwarf))
+	})
+
+	It("should report by package", func() {
+		report := r.SelfTest("github.com/u2386/go-hijack/runtime")
+		Expect(report.Packages).To(HaveLen(1))
+
+		pr := report.Packages[0]
+		Expect(pr.Package).To(Equal("github.com/u2386/go-hijack/runtime"))
+		Expect(pr.Total).To(Equal(report.Total))
+		Expect(pr.Funcs).To(HaveLen(pr.Total))
+		Expect(pr.Patchable).To(Equal(report.Patchable))
+
+		failed := 0
+		for reason, n := range report.Reasons {
+			Expect(reason).To(BeElementOf(
+				ReasonNoDwarf, ReasonNoCode, ReasonInlined, ReasonTooShort,
+				ReasonUnsupportedType, ReasonUnreadableType, ReasonABIWrapper, ReasonRuntimeInternal,
+			))
+			failed += n
+		}
+		Expect(report.Patchable + failed).To(Equal(report.Total))
+		Expect(pr.Funcs).To(ContainElement(Patchability{
+			Func:      "github.com/u2386/go-hijack/runtime.this_is_for_test",
+			Patchable: true,
+		}))
+	})
+})
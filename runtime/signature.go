@@ -0,0 +1,150 @@
+package runtime
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+type (
+	Param struct {
+		Index int    `json:"index"`
+		Name  string `json:"name"`
+		Type  string `json:"type"`
+		Kind  string `json:"kind"`
+
+		// Action is the hijack action able to target this parameter, and
+		// Shape the JSON value it accepts.
+		Action Action `json:"action,omitempty"`
+		Shape  string `json:"shape,omitempty"`
+	}
+
+	Signature struct {
+		Name      string  `json:"name"`
+		Signature string  `json:"signature"`
+		Receiver  *Param  `json:"receiver,omitempty"`
+		Params    []Param `json:"params"`
+		Results   []Param `json:"results"`
+		Variadic  bool    `json:"variadic,omitempty"`
+		Error     string  `json:"error,omitempty"`
+	}
+)
+
+const (
+	ShapeBool   = "bool"
+	ShapeNumber = "number"
+	ShapeString = "string"
+	ShapeArray  = "array"
+	ShapeObject = "object"
+	ShapeAny    = "any"
+)
+
+// closureRegexp matches the last element of closures, and of the wrappers
+// generated for go and defer statements, as in `pkg.F.gowrap1`.
+var closureRegexp = regexp.MustCompile(`^(func|gowrap|deferwrap)?\d+$`)
+
+// isMethod reports whether a function symbol such as `pkg.(*T).M` or `pkg.T.M`
+// names a method, as opposed to a plain function or a closure `pkg.F.func1`.
+func isMethod(name string) bool {
+	base := strings.TrimPrefix(name, FuncPackage(name)+".")
+	if strings.HasPrefix(base, "(") {
+		return true
+	}
+	v := strings.Split(base, ".")
+	return len(v) > 1 && !closureRegexp.MatchString(v[1])
+}
+
+// shapeOf returns the JSON value that Set and Return decode into typ, or
+// nothing for types only null fits, such as channels and functions.
+func shapeOf(typ reflect.Type) string {
+	if typ == nil {
+		return ""
+	}
+	switch typ {
+	case errorType, durationType:
+		return ShapeString
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return ShapeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return ShapeNumber
+	case reflect.String:
+		return ShapeString
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return ShapeString
+		}
+		return ShapeArray
+	case reflect.Complex64, reflect.Complex128:
+		return ShapeArray
+	case reflect.Struct, reflect.Map:
+		return ShapeObject
+	case reflect.Ptr:
+		if typ.Elem() != typ {
+			return shapeOf(typ.Elem())
+		}
+	case reflect.Interface:
+		return ShapeAny
+	}
+	return ""
+}
+
+func (r *Runtime) Signature(name string) (*Signature, error) {
+	name, err := r.resolveName(name)
+	if err != nil {
+		return nil, err
+	}
+	node := r.dwarftrees[name]
+
+	params, err := r.types.formalParameters(node)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := &Signature{
+		Name:      name,
+		Signature: signatureOf(node, params),
+		Params:    []Param{},
+		Results:   []Param{},
+	}
+	if typ, err := r.makeFunc(node); err != nil {
+		sig.Error = err.Error()
+	} else {
+		sig.Variadic = typ.IsVariadic()
+	}
+
+	for _, p := range params {
+		param := Param{
+			Name: p.Name,
+			Type: p.Type.String(),
+			Kind: p.Type.Common().ReflectKind.String(),
+		}
+
+		rt, err := r.types.Type(p.Type)
+		if err == nil {
+			param.Kind = rt.Kind().String()
+		}
+
+		if p.Return {
+			param.Index = len(sig.Results)
+			if param.Shape = shapeOf(rt); param.Shape != "" && sig.Error == "" {
+				param.Action = RETURN
+			}
+			sig.Results = append(sig.Results, param)
+		} else {
+			param.Index = len(sig.Params)
+			if param.Shape = shapeOf(rt); param.Shape != "" && sig.Error == "" {
+				param.Action = SET
+			}
+			sig.Params = append(sig.Params, param)
+		}
+	}
+
+	if isMethod(name) && len(sig.Params) > 0 {
+		sig.Receiver = &sig.Params[0]
+	}
+	return sig, nil
+}
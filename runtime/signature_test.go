@@ -0,0 +1,76 @@
+package runtime
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Function Signature", func() {
+	var (
+		r *Runtime
+	)
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	It("should tell methods from closures", func() {
+		Expect(isMethod("net/http.(*Request).Context")).Should(BeTrue())
+		Expect(isMethod("time.Time.Unix")).Should(BeTrue())
+		Expect(isMethod("main.main")).Should(BeFalse())
+		Expect(isMethod("main.main.func1")).Should(BeFalse())
+		Expect(isMethod("main.main.func1.2")).Should(BeFalse())
+		Expect(isMethod("main.main.gowrap1")).Should(BeFalse())
+		Expect(isMethod("main.serve.func1.deferwrap2")).Should(BeFalse())
+	})
+
+	It("should advertise the shapes Set and Return decode", func() {
+		Expect(shapeOf(reflect.TypeOf(uint8(0)))).To(Equal(ShapeNumber))
+		Expect(shapeOf(reflect.TypeOf(time.Second))).To(Equal(ShapeString))
+		Expect(shapeOf(reflect.TypeOf([]byte{}))).To(Equal(ShapeString))
+		Expect(shapeOf(reflect.TypeOf([]int{}))).To(Equal(ShapeArray))
+		Expect(shapeOf(reflect.TypeOf(&http.Request{}))).To(Equal(ShapeObject))
+		Expect(shapeOf(reflect.TypeOf(map[string]int{}))).To(Equal(ShapeObject))
+		Expect(shapeOf(errorType)).To(Equal(ShapeString))
+		Expect(shapeOf(reflect.TypeOf(make(chan int)))).To(BeEmpty())
+	})
+
+	It("should describe params and results", func() {
+		sig, err := r.Signature("github.com/u2386/go-hijack/runtime.test_for_two_returns")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sig.Error).To(BeEmpty())
+		Expect(sig.Receiver).To(BeNil())
+		Expect(sig.Signature).To(HavePrefix("github.com/u2386/go-hijack/runtime.test_for_two_returns(i int)"))
+
+		Expect(sig.Params).To(HaveLen(1))
+		Expect(sig.Params[0].Name).To(Equal("i"))
+		Expect(sig.Params[0].Type).To(Equal("int"))
+		Expect(sig.Params[0].Kind).To(Equal("int"))
+		Expect(sig.Params[0].Action).To(Equal(SET))
+		Expect(sig.Params[0].Shape).To(Equal(ShapeNumber))
+
+		Expect(sig.Results).To(HaveLen(2))
+		Expect(sig.Results[0].Kind).To(Equal("string"))
+		Expect(sig.Results[0].Action).To(Equal(RETURN))
+		Expect(sig.Results[1].Index).To(Equal(1))
+		Expect(sig.Results[1].Type).To(Equal("error"))
+		Expect(sig.Results[1].Shape).To(Equal(ShapeString))
+	})
+
+	It("should describe the receiver", func() {
+		sig, err := r.Signature("github.com/u2386/go-hijack/runtime.(*test_iface_impl).doing_something")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sig.Receiver).ShouldNot(BeNil())
+		Expect(sig.Receiver.Index).To(BeZero())
+		Expect(sig.Receiver.Kind).To(Equal("ptr"))
+	})
+
+	It("should return error", func() {
+		_, err := r.Signature("unknown")
+		Expect(err).Should(MatchError(ErrPointNotFound))
+	})
+})
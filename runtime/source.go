@@ -0,0 +1,288 @@
+package runtime
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+type (
+	Location struct {
+		Func      string `json:"func"`
+		File      string `json:"file"`
+		DeclLine  int    `json:"decl_line"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+		Entry     uint64 `json:"entry"`
+		End       uint64 `json:"end"`
+	}
+
+	SourceLine struct {
+		Line int    `json:"line"`
+		Text string `json:"text"`
+	}
+
+	Source struct {
+		Location
+		Lines []SourceLine `json:"lines,omitempty"`
+	}
+
+	funcRange struct {
+		name   string
+		lowpc  uint64
+		highpc uint64
+	}
+)
+
+const SourceContext = 3
+
+var (
+	ErrPositionNotFound  = errors.New("source position not found")
+	ErrAmbiguousPosition = errors.New("ambiguous source position")
+	positionRegexp       = regexp.MustCompile(`^(.+\.go):(\d+)$`)
+)
+
+// ParsePosition splits a `file.go:123` position, reporting false for anything
+// else such as a symbol name.
+func ParsePosition(s string) (string, int, bool) {
+	m := positionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return m[1], line, true
+}
+
+func pcRange(tree *godwarf.Tree) (uint64, uint64, bool) {
+	lowpc, ok := tree.Entry.Val(dwarf.AttrLowpc).(uint64)
+	if !ok {
+		return 0, 0, false
+	}
+	switch highpc := tree.Entry.Val(dwarf.AttrHighpc).(type) {
+	case uint64:
+		return lowpc, highpc, true
+	case int64:
+		return lowpc, lowpc + uint64(highpc), true
+	}
+	return 0, 0, false
+}
+
+func sameFile(name, file string) bool {
+	return name == file || strings.HasSuffix(name, "/"+file)
+}
+
+func (r *Runtime) funcRanges() []funcRange {
+	r.rangeOnce.Do(func() {
+		for name, tree := range r.dwarftrees {
+			if lowpc, highpc, ok := pcRange(tree); ok {
+				r.ranges = append(r.ranges, funcRange{name: name, lowpc: lowpc, highpc: highpc})
+			}
+		}
+		sort.Slice(r.ranges, func(i, j int) bool { return r.ranges[i].lowpc < r.ranges[j].lowpc })
+	})
+	return r.ranges
+}
+
+func (r *Runtime) funcAt(pc uint64) (string, bool) {
+	ranges := r.funcRanges()
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].lowpc > pc }) - 1
+	if i < 0 || pc >= ranges[i].highpc {
+		return "", false
+	}
+	return ranges[i].name, true
+}
+
+// Locate maps a function to the file and line range its code comes from,
+// using the DWARF line program of its compile unit.
+func (r *Runtime) Locate(name string) (*Location, error) {
+	name, err := r.resolveName(name)
+	if err != nil {
+		return nil, err
+	}
+	node := r.dwarftrees[name]
+	lowpc, highpc, ok := pcRange(node)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no code", ErrPositionNotFound, name)
+	}
+
+	loc := &Location{Func: name, File: r.declFile(node.Offset), Entry: lowpc, End: highpc}
+	if line, ok := node.Entry.Val(dwarf.AttrDeclLine).(int64); ok {
+		loc.DeclLine = int(line)
+	}
+
+	cu, err := r.dwarf.Reader().SeekPC(lowpc)
+	if err != nil {
+		return nil, err
+	}
+	lr, err := r.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil, fmt.Errorf("%w: %s has no line table", ErrPositionNotFound, name)
+	}
+
+	var entry dwarf.LineEntry
+	for err = lr.SeekPC(lowpc, &entry); err == nil && entry.Address < highpc; err = lr.Next(&entry) {
+		if entry.EndSequence || entry.File == nil || entry.Line == 0 || r.inlinedAt(node, entry.Address) {
+			continue
+		}
+		if loc.File == "" {
+			loc.File = entry.File.Name
+		}
+		if entry.File.Name != loc.File {
+			continue
+		}
+		if loc.StartLine == 0 || entry.Line < loc.StartLine {
+			loc.StartLine = entry.Line
+		}
+		if entry.Line > loc.EndLine {
+			loc.EndLine = entry.Line
+		}
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if loc.DeclLine != 0 && loc.DeclLine < loc.StartLine {
+		loc.StartLine = loc.DeclLine
+	}
+	return loc, nil
+}
+
+// inlinedAt reports whether pc lies in a function inlined into node.
+func (r *Runtime) inlinedAt(node *godwarf.Tree, pc uint64) bool {
+	for _, child := range node.Children {
+		if child.Tag == dwarf.TagInlinedSubroutine {
+			entry, ok := child.Entry.(*dwarf.Entry)
+			if !ok {
+				continue
+			}
+			ranges, err := r.dwarf.Ranges(entry)
+			if err != nil {
+				continue
+			}
+			for _, rng := range ranges {
+				if pc >= rng[0] && pc < rng[1] {
+					return true
+				}
+			}
+			continue
+		}
+		if r.inlinedAt(child, pc) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup resolves a `file.go:123` position to the functions whose code is
+// generated from it. The file matches by path suffix.
+func (r *Runtime) Lookup(pos string) ([]Location, error) {
+	file, line, ok := ParsePosition(pos)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPositionNotFound, pos)
+	}
+
+	found := make(map[string]bool)
+	reader := r.dwarf.Reader()
+	for cu, err := reader.Next(); cu != nil; cu, err = reader.Next() {
+		if err != nil {
+			return nil, err
+		}
+		reader.SkipChildren()
+		if cu.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+
+		lr, err := r.dwarf.LineReader(cu)
+		if err != nil || lr == nil {
+			continue
+		}
+
+		var entry dwarf.LineEntry
+		for err := lr.Next(&entry); err == nil; err = lr.Next(&entry) {
+			if entry.Line != line || entry.File == nil || !sameFile(entry.File.Name, file) {
+				continue
+			}
+			// Code inlined from elsewhere keeps the position of the callee, but
+			// lies within the caller.
+			if name, ok := r.funcAt(entry.Address); ok && !r.inlinedAt(r.dwarftrees[name], entry.Address) {
+				found[name] = true
+			}
+		}
+	}
+
+	var locs []Location
+	for name := range found {
+		loc, err := r.Locate(name)
+		if err != nil || !sameFile(loc.File, file) || line < loc.StartLine || line > loc.EndLine {
+			continue
+		}
+		locs = append(locs, *loc)
+	}
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPositionNotFound, pos)
+	}
+	sort.Slice(locs, func(i, j int) bool { return locs[i].Func < locs[j].Func })
+	return locs, nil
+}
+
+// Resolve returns the function a target names, either by a source position or
+// by a possibly short symbol name.
+func (r *Runtime) Resolve(target string) (string, error) {
+	if _, _, ok := ParsePosition(target); !ok {
+		return r.resolveName(target)
+	}
+
+	locs, err := r.Lookup(target)
+	if err != nil {
+		return "", err
+	}
+	if len(locs) > 1 {
+		var ns []string
+		for _, loc := range locs {
+			ns = append(ns, loc.Func)
+		}
+		return "", fmt.Errorf("%w: %s matches %s", ErrAmbiguousPosition, target, strings.Join(ns, ", "))
+	}
+	return locs[0].Func, nil
+}
+
+// Source locates a function, by name or position, and reads its code from
+// disk with `context` surrounding lines when the file is available.
+func (r *Runtime) Source(target string, context int) (*Source, error) {
+	name, err := r.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := r.Locate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &Source{Location: *loc}
+	f, err := os.Open(loc.File)
+	if err != nil {
+		debug("source unavailable:%s", err)
+		return src, nil
+	}
+	defer f.Close()
+
+	from, to := loc.StartLine-context, loc.EndLine+context
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan() && n <= to; n++ {
+		if n >= from {
+			src.Lines = append(src.Lines, SourceLine{Line: n, Text: scanner.Text()})
+		}
+	}
+	return src, nil
+}
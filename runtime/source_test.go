@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	"context"
+	"debug/dwarf"
+	"fmt"
+	"reflect"
+	goruntime "runtime"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:noinline
+func test_for_source_lookup(i int) string {
+	return fmt.Sprint(i)
+}
+
+var _ = test_for_source_lookup(0)
+
+var _ = Describe("Test Source Location", func() {
+	var (
+		r    *Runtime
+		name = "github.com/u2386/go-hijack/runtime.test_for_source_lookup"
+		line int
+	)
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+		pc := reflect.ValueOf(test_for_source_lookup).Pointer()
+		_, line = goruntime.FuncForPC(pc).FileLine(pc)
+	})
+
+	It("should parse positions", func() {
+		file, n, ok := ParsePosition("main.go:42")
+		Expect(ok).Should(BeTrue())
+		Expect(file).To(Equal("main.go"))
+		Expect(n).To(Equal(42))
+
+		_, _, ok = ParsePosition("main.main")
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should locate a function", func() {
+		loc, err := r.Locate(name)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(loc.File).To(HaveSuffix("source_test.go"))
+		Expect(loc.DeclLine).To(Equal(line))
+		Expect(loc.StartLine).To(Equal(line))
+		Expect(loc.EndLine).To(Equal(line + 1))
+		Expect(loc.End > loc.Entry).Should(BeTrue())
+	})
+
+	It("should lookup a function by position", func() {
+		locs, err := r.Lookup(fmt.Sprintf("runtime/source_test.go:%d", line+1))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(locs).To(HaveLen(1))
+		Expect(locs[0].Func).To(Equal(name))
+
+		_, err = r.Lookup("unknown.go:1")
+		Expect(err).Should(MatchError(ErrPositionNotFound))
+	})
+
+	It("should not take inlined code for its caller", func() {
+		// strings.HasPrefix is only ever inlined, so no function has its body.
+		node := r.dwarftrees["strings.HasPrefix"]
+		Expect(node).ShouldNot(BeNil())
+		decl := node.Entry.Val(dwarf.AttrDeclLine).(int64)
+
+		pos := fmt.Sprintf("strings/strings.go:%d", decl+1)
+
+		_, err := r.Lookup(pos)
+		Expect(err).Should(MatchError(ErrPositionNotFound))
+		_, err = r.Resolve(pos)
+		Expect(err).Should(MatchError(ErrPositionNotFound))
+	})
+
+	It("should read the source", func() {
+		src, err := r.Source(fmt.Sprintf("source_test.go:%d", line+1), 1)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(src.Lines).To(HaveLen(4))
+		Expect(src.Lines[1].Line).To(Equal(line))
+		Expect(src.Lines[2].Text).To(ContainSubstring("return fmt.Sprint(i)"))
+		Expect(src.Lines[3].Text).To(Equal("}"))
+	})
+
+	It("should hijack by position", func() {
+		var target string
+		r.patches["u2386"] = func(_ *Runtime, m Request) (*Guard, error) { target = m["func"].(string); return nil, nil }
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Run(ctx)
+
+		err := r.Hijack(map[string]interface{}{"func": fmt.Sprintf("source_test.go:%d", line+1), "action": "u2386"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(target).To(Equal(name))
+		r.M.Delete(name)
+	})
+})
@@ -0,0 +1,184 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type NotFoundError struct {
+	Func        string
+	Suggestions []string
+}
+
+const MaxSuggestions = 5
+
+func (e *NotFoundError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("%s: %s", ErrPointNotFound, e.Func)
+	}
+	return fmt.Sprintf("%s: %s, did you mean %s?", ErrPointNotFound, e.Func, strings.Join(e.Suggestions, ", "))
+}
+
+func (e *NotFoundError) Unwrap() error { return ErrPointNotFound }
+
+// normalize drops the package path and the pointer receiver notation, so that
+// `github.com/org/svc.(*T).M` reads as `svc.T.M`.
+func normalize(name string) string {
+	name = name[strings.LastIndex(name, "/")+1:]
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
+
+// member returns a symbol name without its package, e.g. `(*T).M`.
+func member(name string) string {
+	return strings.TrimPrefix(name, FuncPackage(name)+".")
+}
+
+// pointerMethod reports whether name is a method with a pointer receiver, as
+// opposed to a function or a closure within such a method.
+func pointerMethod(name string) bool {
+	m := member(name)
+	i := strings.Index(m, ")")
+	return strings.HasPrefix(m, "(*") && i > 0 && strings.Count(m[i:], ".") == 1
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// matchSuffix reports whether a short name such as `svc.DoingSomething` or
+// `svc.T.M` refers to the function `name`.
+func matchSuffix(name, short string) bool {
+	if strings.HasSuffix(name, "/"+short) || strings.HasSuffix(name, "."+short) {
+		return true
+	}
+	n, s := normalize(name), normalize(short)
+	return n == s || strings.HasSuffix(n, "."+s)
+}
+
+// suggest ranks candidates by how likely they were meant: same member in
+// another package first, then by edit distance of the normalized names or of
+// the members alone.
+func (r *Runtime) suggest(name string) []string {
+	type candidate struct {
+		name     string
+		sameName bool
+		distance int
+	}
+
+	short, mem := normalize(name), normalize(member(name))
+	limit := len(mem) / 3
+	if limit < 3 {
+		limit = 3
+	}
+
+	var cs []candidate
+	for n := range r.dwarftrees {
+		c := candidate{name: n, sameName: member(n) == member(name)}
+		c.distance = levenshtein(short, normalize(n))
+		if d := levenshtein(mem, normalize(member(n))); d < c.distance {
+			c.distance = d
+		}
+		if c.sameName || c.distance <= limit {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].sameName != cs[j].sameName {
+			return cs[i].sameName
+		}
+		if cs[i].distance != cs[j].distance {
+			return cs[i].distance < cs[j].distance
+		}
+		return cs[i].name < cs[j].name
+	})
+
+	var ns []string
+	for i := 0; i < len(cs) && i < MaxSuggestions; i++ {
+		ns = append(ns, cs[i].name)
+	}
+	return ns
+}
+
+// preferReceiver drops the wrapper generated for `(*T).M` when the method
+// `T.M` also matches, unless the short name asked for the pointer receiver.
+func preferReceiver(matches []string, short string) []string {
+	found := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		found[m] = true
+	}
+
+	var ns []string
+	for _, m := range matches {
+		pkg := FuncPackage(m)
+		base := strings.TrimPrefix(m, pkg+".")
+		if i := strings.Index(base, ")"); strings.HasPrefix(base, "(*") && i > 0 {
+			if found[pkg+"."+base[2:i]+base[i+1:]] && !strings.Contains(short, "(*") {
+				continue
+			}
+		} else if strings.Contains(short, "(*") && found[pkg+".(*"+strings.Replace(base, ".", ").", 1)] {
+			continue
+		}
+		ns = append(ns, m)
+	}
+	return ns
+}
+
+// resolveName returns the function a possibly short name refers to. An
+// unambiguous suffix match resolves automatically, otherwise the error
+// carries the closest matches.
+func (r *Runtime) resolveName(name string) (string, error) {
+	if _, ok := r.dwarftrees[name]; ok {
+		return name, nil
+	}
+	if name == "" {
+		return "", &NotFoundError{Func: name}
+	}
+
+	var matches []string
+	for n := range r.dwarftrees {
+		if matchSuffix(n, name) {
+			matches = append(matches, n)
+		}
+	}
+	matches = preferReceiver(matches, name)
+	if len(matches) == 1 {
+		debug("resolve %s as %s", name, matches[0])
+		return matches[0], nil
+	}
+
+	sort.Strings(matches)
+	if len(matches) > MaxSuggestions {
+		matches = matches[:MaxSuggestions]
+	}
+	if len(matches) == 0 {
+		matches = r.suggest(name)
+	}
+	return "", &NotFoundError{Func: name, Suggestions: matches}
+}
@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Function Suggestions", func() {
+	var (
+		r *Runtime
+	)
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	It("should compute edit distance", func() {
+		Expect(levenshtein("", "")).To(Equal(0))
+		Expect(levenshtein("kitten", "sitting")).To(Equal(3))
+		Expect(levenshtein("abc", "")).To(Equal(3))
+	})
+
+	It("should normalize names", func() {
+		Expect(normalize("github.com/org/svc.(*T).M")).To(Equal("svc.T.M"))
+		Expect(member("github.com/org/svc.(*T).M")).To(Equal("(*T).M"))
+	})
+
+	It("should resolve unambiguous short names", func() {
+		name, err := r.Resolve("runtime.this_is_for_test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(name).To(Equal("github.com/u2386/go-hijack/runtime.this_is_for_test"))
+
+		name, err = r.Resolve("runtime.test_iface_impl.doing_something")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(name).To(Equal("github.com/u2386/go-hijack/runtime.(*test_iface_impl).doing_something"))
+	})
+
+	It("should prefer value receivers to their pointer wrappers", func() {
+		Expect(r.dwarftrees).Should(HaveKey("time.(*Time).String"))
+
+		name, err := r.Resolve("time.Time.String")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(name).To(Equal("time.Time.String"))
+
+		name, err = r.Resolve("Time.String")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(name).To(Equal("time.Time.String"))
+
+		name, err = r.Resolve("(*Time).String")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(name).To(Equal("time.(*Time).String"))
+	})
+
+	It("should suggest the same function in another package", func() {
+		_, err := r.Resolve("main.this_is_for_test")
+		Expect(err).Should(MatchError(ErrPointNotFound))
+
+		var e *NotFoundError
+		Expect(errors.As(err, &e)).Should(BeTrue())
+		Expect(e.Suggestions).ShouldNot(BeEmpty())
+		Expect(e.Suggestions[0]).To(Equal("github.com/u2386/go-hijack/runtime.this_is_for_test"))
+	})
+
+	It("should suggest typos", func() {
+		_, err := r.Resolve("github.com/u2386/go-hijack/runtime.this_is_for_tset")
+
+		var e *NotFoundError
+		Expect(errors.As(err, &e)).Should(BeTrue())
+		Expect(e.Suggestions).Should(ContainElement("github.com/u2386/go-hijack/runtime.this_is_for_test"))
+		Expect(err.Error()).Should(ContainSubstring("did you mean"))
+	})
+
+	It("should release points by the names they were hijacked by", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.Run(ctx)
+
+		const name = "github.com/u2386/go-hijack/runtime.test_for_unnamed"
+		loc, err := r.Locate(name)
+		Expect(err).ShouldNot(HaveOccurred())
+		pos := fmt.Sprintf("%s:%d", filepath.Base(loc.File), loc.StartLine+1)
+
+		for _, target := range []string{"runtime.test_for_unnamed", pos} {
+			Expect(r.Hijack(Request{"Func": "runtime.test_for_unnamed", "action": "return", "index": 1, "val": "io.EOF"})).To(Succeed())
+			Expect(r.Points()).To(Equal([]string{name}))
+			_, err = test_for_unnamed(1)
+			Expect(err).To(Equal(io.EOF))
+
+			r.Release(target)
+			Expect(r.Points()).To(BeEmpty(), target)
+			_, err = test_for_unnamed(1)
+			Expect(err).To(BeNil())
+		}
+	})
+
+	It("should fail hijacking a mistyped function", func() {
+		_, err := (&patcher{}).Delay(r, map[string]interface{}{
+			"func":   "this_is_for_tset",
+			"action": "delay",
+			"val":    10,
+		})
+		Expect(err).Should(MatchError(ErrPointNotFound))
+		Expect(err.Error()).Should(ContainSubstring("this_is_for_test"))
+	})
+})
@@ -0,0 +1,108 @@
+package runtime
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"unsafe"
+)
+
+type Toolchain struct {
+	GoVersion    string            `json:"go_version"`
+	Major        int               `json:"major"`
+	Minor        int               `json:"minor"`
+	Path         string            `json:"path,omitempty"`
+	DWARFVersion int               `json:"dwarf_version"`
+	Settings     map[string]string `json:"settings,omitempty"`
+}
+
+var (
+	ErrUnsupportedToolchain = errors.New("unsupported toolchain")
+	ErrNoDwarf              = errors.New("no dwarf")
+	goVersionRegexp         = regexp.MustCompile(`go(\d+)\.(\d+)`)
+)
+
+// readBuildVersion reads the string `runtime.buildVersion` from memory, which
+// only works when the binary is the running process itself.
+func readBuildVersion(pid int, symbols map[string]elf.Symbol) string {
+	sym, ok := symbols["runtime.buildVersion"]
+	if !ok || pid != os.Getpid() {
+		return ""
+	}
+	addr := uintptr(sym.Value)
+	return *(*string)(*(*unsafe.Pointer)(unsafe.Pointer(&addr)))
+}
+
+// dwarfVersion returns the version of the first compile unit header.
+func dwarfVersion(ef *elf.File) int {
+	sec := ef.Section(".debug_info")
+	if sec == nil {
+		return 0
+	}
+	b := make([]byte, 6)
+	if _, err := sec.Open().Read(b); err != nil {
+		return 0
+	}
+	// A 64-bit unit length is escaped by 0xffffffff.
+	if binary.LittleEndian.Uint32(b) == 0xffffffff {
+		b = make([]byte, 14)
+		if _, err := sec.Open().Read(b); err != nil {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint16(b[12:]))
+	}
+	return int(binary.LittleEndian.Uint16(b[4:]))
+}
+
+func ReadToolchain(pid int, ef *elf.File, symbols map[string]elf.Symbol) *Toolchain {
+	t := &Toolchain{
+		GoVersion:    readBuildVersion(pid, symbols),
+		DWARFVersion: dwarfVersion(ef),
+	}
+
+	if bi, err := buildinfo.ReadFile(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		t.GoVersion = bi.GoVersion
+		t.Path = bi.Path
+		t.Settings = make(map[string]string)
+		for _, s := range bi.Settings {
+			t.Settings[s.Key] = s.Value
+		}
+	} else {
+		debug("read buildinfo:%s", err)
+	}
+
+	if m := goVersionRegexp.FindStringSubmatch(t.GoVersion); m != nil {
+		t.Major, _ = strconv.Atoi(m[1])
+		t.Minor, _ = strconv.Atoi(m[2])
+	}
+	return t
+}
+
+// AtLeast reports whether the binary was built by go1.minor or later. An
+// unknown version is assumed recent.
+func (t *Toolchain) AtLeast(major, minor int) bool {
+	if t.Major == 0 {
+		return true
+	}
+	return t.Major > major || t.Major == major && t.Minor >= minor
+}
+
+// Check refuses actions known to be broken for the binary: reading DWARF 5
+// and, before go1.10, telling results from parameters, which needs
+// DW_AT_variable_parameter and DW_AT_go_runtime_type.
+func (t *Toolchain) Check(action Action) error {
+	switch {
+	case t.DWARFVersion == 0:
+		return fmt.Errorf("%w: binary is stripped, rebuild without -ldflags=-w", ErrNoDwarf)
+	case t.DWARFVersion >= 5:
+		return fmt.Errorf("%w: DWARF %d of %s is unreadable, rebuild with GOEXPERIMENT=nodwarf5", ErrUnsupportedToolchain, t.DWARFVersion, t.GoVersion)
+	case action != SETVAR && !t.AtLeast(1, 10):
+		return fmt.Errorf("%w: %s cannot tell results from parameters, go1.10 or later required", ErrUnsupportedToolchain, t.GoVersion)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package runtime
+
+import (
+	"debug/elf"
+	"fmt"
+	goruntime "runtime"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Toolchain", func() {
+	It("should read the toolchain", func() {
+		ef, err := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+		Expect(err).ShouldNot(HaveOccurred())
+		syms, _ := ef.Symbols()
+		symbols := make(map[string]elf.Symbol)
+		for _, sym := range syms {
+			symbols[sym.Name] = sym
+		}
+
+		Expect(readBuildVersion(pid, symbols)).To(Equal(goruntime.Version()))
+
+		t := ReadToolchain(pid, ef, symbols)
+		Expect(t.GoVersion).To(Equal(goruntime.Version()))
+		Expect(t.Major).To(Equal(1))
+		Expect(t.DWARFVersion).To(Equal(4))
+		Expect(t.Settings).To(HaveKey("GOARCH"))
+		Expect(t.Check(DELAY)).ShouldNot(HaveOccurred())
+	})
+
+	It("should refuse broken toolchains", func() {
+		Expect((&Toolchain{}).Check(DELAY)).Should(MatchError(ErrNoDwarf))
+		Expect((&Toolchain{GoVersion: "go1.25.0", Major: 1, Minor: 25, DWARFVersion: 5}).Check(DELAY)).Should(MatchError(ErrUnsupportedToolchain))
+
+		old := &Toolchain{GoVersion: "go1.9.7", Major: 1, Minor: 9, DWARFVersion: 4}
+		Expect(old.Check(DELAY)).Should(MatchError(ErrUnsupportedToolchain))
+		Expect(old.Check(SETVAR)).ShouldNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,322 @@
+package runtime
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Trigger decides, call by call, whether a hijack point fires. Calls are
+	// numbered and drawn for in order, so that a seed replays a run. Behind a
+	// gate, the trigger works out ahead how many calls are certain not to
+	// fire, by their numbers and by drawing for them, and the gate lets those
+	// through before any reflective work. Calls before a point starts, and
+	// to functions whose prologue the gate cannot move, still reach the
+	// replacement; a gated call that grows its stack is counted twice.
+	Trigger struct {
+		point       HijackPoint
+		probability float64
+
+		// Calls numbered lo to hi, 1 based, are in the window, every one of
+		// them or every nth. A zero hi leaves the window open.
+		lo, hi uint64
+		every  uint64
+
+		// Calls between start and end are counted, when those are set.
+		start, end time.Time
+
+		calls uint64
+		fired uint64
+
+		mu        sync.Mutex
+		rand      *rand.Rand
+		drawn     bool
+		gate      *gate
+		exhausted bool
+		done      func()
+		timer     *time.Timer
+	}
+
+	// PointStat describes a live hijack point and how often it fired.
+	PointStat struct {
+		Func      string  `json:"func"`
+		Action    Action  `json:"action"`
+		Calls     uint64  `json:"calls"`
+		Fired     uint64  `json:"fired"`
+		Remaining *uint64 `json:"remaining,omitempty"`
+		StartsIn  string  `json:"starts_in,omitempty"`
+		ExpiresIn string  `json:"expires_in,omitempty"`
+	}
+)
+
+func (p *HijackPoint) trigger() (*Trigger, error) {
+	t := &Trigger{point: *p, probability: 1, lo: 1, hi: p.First, every: p.Every}
+	if p.Probability != nil {
+		if *p.Probability < 0 || *p.Probability > 1 {
+			return nil, fmt.Errorf("%w: probability %v is not within [0, 1]", ErrUnsupportAction, *p.Probability)
+		}
+		t.probability = *p.Probability
+	}
+
+	if p.After > 0 {
+		t.lo = p.After + 1
+	}
+	if len(p.Between) > 0 {
+		if len(p.Between) != 2 || p.Between[0] == 0 || p.Between[0] > p.Between[1] {
+			return nil, fmt.Errorf("%w: between %v is not a range of calls", ErrUnsupportAction, p.Between)
+		}
+		if p.Between[0] > t.lo {
+			t.lo = p.Between[0]
+		}
+		if t.hi == 0 || p.Between[1] < t.hi {
+			t.hi = p.Between[1]
+		}
+	}
+	if t.hi > 0 && t.lo > t.hi {
+		return nil, fmt.Errorf("%w: no call is both after %d and within the first %d", ErrUnsupportAction, t.lo-1, t.hi)
+	}
+
+	if err := t.schedule(p, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if t.probability < 1 {
+		seed := time.Now().UnixNano()
+		if p.Seed != nil {
+			seed = *p.Seed
+		}
+		t.rand = rand.New(rand.NewSource(seed))
+	}
+	return t, nil
+}
+
+// schedule sets the lifetime of the point from now: it starts at StartAt, and
+// ends at EndAt or once its TTL elapsed, whichever comes first.
+func (t *Trigger) schedule(p *HijackPoint, now time.Time) error {
+	var err error
+	if p.StartAt != "" {
+		if t.start, err = time.Parse(time.RFC3339, p.StartAt); err != nil {
+			return fmt.Errorf("%w: start_at %s", ErrUnsupportAction, err)
+		}
+	}
+	if p.EndAt != "" {
+		if t.end, err = time.Parse(time.RFC3339, p.EndAt); err != nil {
+			return fmt.Errorf("%w: end_at %s", ErrUnsupportAction, err)
+		}
+	}
+	if p.TTL != "" {
+		ttl, err := time.ParseDuration(p.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("%w: ttl %q is not a positive duration", ErrUnsupportAction, p.TTL)
+		}
+		if end := now.Add(ttl); t.end.IsZero() || end.Before(t.end) {
+			t.end = end
+		}
+	}
+
+	if !t.end.IsZero() {
+		if !t.end.After(now) {
+			return fmt.Errorf("%w: point ended at %s", ErrUnsupportAction, t.end.Format(time.RFC3339))
+		}
+		if !t.start.IsZero() && !t.end.After(t.start) {
+			return fmt.Errorf("%w: point ends before it starts", ErrUnsupportAction)
+		}
+	}
+	return nil
+}
+
+// perCall reports whether the trigger depends on the calls it sees, as
+// opposed to deciding once.
+func (t *Trigger) perCall() bool {
+	return t.lo > 1 || t.hi > 0 || t.every > 0 || !t.start.IsZero()
+}
+
+// Fire counts a call, and reports whether the point fires on it.
+func (t *Trigger) Fire() bool {
+	if !t.start.IsZero() || !t.end.IsZero() {
+		now := time.Now()
+		if now.Before(t.start) || (!t.end.IsZero() && !now.Before(t.end)) {
+			return false
+		}
+	}
+
+	t.mu.Lock()
+	n := atomic.AddUint64(&t.calls, 1)
+	fire := t.decide(n)
+	t.grant(n)
+	t.mu.Unlock()
+
+	if t.hi > 0 && n == t.hi {
+		t.exhaust()
+	}
+	if fire {
+		atomic.AddUint64(&t.fired, 1)
+	}
+	return fire
+}
+
+// decide reports whether the nth call fires, drawing for it unless that was
+// done ahead.
+func (t *Trigger) decide(n uint64) bool {
+	if (t.hi > 0 && n > t.hi) || n < t.lo || (t.every > 0 && n%t.every != 0) {
+		return false
+	}
+	if t.rand == nil {
+		return true
+	}
+	if t.drawn {
+		t.drawn = false
+		return true
+	}
+	return t.rand.Float64() < t.probability
+}
+
+// gated puts the trigger behind g, which is let through the first calls if
+// they are certain not to fire.
+func (t *Trigger) gated(g *gate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.gate = g
+	if t.start.IsZero() || !time.Now().Before(t.start) {
+		t.grant(atomic.LoadUint64(&t.calls))
+	}
+}
+
+// grant lets the gate through the calls after the nth that are certain not
+// to fire, and numbers them at once, so that the next call the gate stops
+// comes after them.
+func (t *Trigger) grant(n uint64) {
+	if t.gate == nil {
+		return
+	}
+	k := t.ahead(n)
+	atomic.AddUint64(&t.calls, k)
+	t.gate.pass(k)
+}
+
+// ahead returns how many of the calls after the nth are certain not to fire.
+// Draws for them are made in order, as they would be call by call, and one
+// that fires is kept for its call. The last call of a window is never let
+// through, as it exhausts the point.
+func (t *Trigger) ahead(n uint64) uint64 {
+	if t.hi > 0 && n >= t.hi {
+		return maxAhead
+	}
+	if t.rand != nil && t.probability == 0 {
+		if t.hi > 0 {
+			return capAhead(t.hi - n - 1)
+		}
+		return maxAhead
+	}
+
+	var k uint64
+	for m, draws := n+1, 0; ; m++ {
+		next := m
+		if next < t.lo {
+			next = t.lo
+		}
+		if t.every > 0 && next%t.every != 0 {
+			next += t.every - next%t.every
+		}
+		if t.hi > 0 && next >= t.hi {
+			return capAhead(k + t.hi - m)
+		}
+		if k += next - m; k >= maxAhead {
+			return maxAhead
+		}
+		m = next
+
+		if t.rand == nil || draws == maxDraws {
+			return k
+		}
+		draws++
+		if t.rand.Float64() < t.probability {
+			t.drawn = true
+			return k
+		}
+		k++
+	}
+}
+
+func capAhead(k uint64) uint64 {
+	if k > maxAhead {
+		return maxAhead
+	}
+	return k
+}
+
+func (t *Trigger) exhaust() {
+	t.mu.Lock()
+	if t.exhausted {
+		t.mu.Unlock()
+		return
+	}
+	t.exhausted = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	done := t.done
+	t.mu.Unlock()
+	if done != nil {
+		done()
+	}
+}
+
+// whenExhausted calls done once the last call of the window came or the
+// point ended, or at once if it already did. The end is kept by a timer of
+// its own, so that the point goes away even if nothing else is left to remove
+// it.
+func (t *Trigger) whenExhausted(done func()) {
+	t.mu.Lock()
+	t.done = done
+	exhausted := t.exhausted
+	if !exhausted && !t.end.IsZero() {
+		t.timer = time.AfterFunc(time.Until(t.end), t.exhaust)
+	}
+	t.mu.Unlock()
+	if exhausted {
+		done()
+	}
+}
+
+// stop stops the timer and drops the callback of a released point.
+func (t *Trigger) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = nil
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *Trigger) Stat() PointStat {
+	stat := PointStat{
+		Func:   t.point.Func,
+		Action: t.point.Action,
+		Calls:  atomic.LoadUint64(&t.calls),
+		Fired:  atomic.LoadUint64(&t.fired),
+	}
+	// Calls numbered for the gate to let through are yet to come.
+	if passing := t.gate.passing(); passing < stat.Calls {
+		stat.Calls -= passing
+	} else {
+		stat.Calls = 0
+	}
+	if t.hi > 0 {
+		var remaining uint64
+		if stat.Calls < t.hi {
+			remaining = t.hi - stat.Calls
+		}
+		stat.Remaining = &remaining
+	}
+	if d := time.Until(t.start); !t.start.IsZero() && d > 0 {
+		stat.StartsIn = d.Round(time.Millisecond).String()
+	}
+	if !t.end.IsZero() {
+		stat.ExpiresIn = time.Until(t.end).Round(time.Millisecond).String()
+	}
+	return stat
+}
@@ -0,0 +1,372 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Trigger", func() {
+	var r *Runtime
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+	})
+
+	trigger := func(m Request) (*Trigger, error) {
+		var point HijackPoint
+		Expect(mapstructure.Decode(m, &point)).To(Succeed())
+		return point.trigger()
+	}
+
+	It("should draw reproducibly from a seed", func() {
+		a, err := trigger(Request{"probability": 0.3, "seed": 7})
+		Expect(err).ShouldNot(HaveOccurred())
+		b, _ := trigger(Request{"probability": 0.3, "seed": 7})
+
+		n := 0
+		for i := 0; i < 10000; i++ {
+			fire := a.Fire()
+			Expect(b.Fire()).To(Equal(fire))
+			if fire {
+				n++
+			}
+		}
+		Expect(n).To(BeNumerically("~", 3000, 200))
+
+		never, _ := trigger(Request{"probability": 0})
+		always, _ := trigger(Request{})
+		for i := 0; i < 100; i++ {
+			Expect(never.Fire()).To(BeFalse())
+			Expect(always.Fire()).To(BeTrue())
+		}
+	})
+
+	It("should refuse a probability out of range", func() {
+		for _, p := range []float64{-0.1, 1.5} {
+			_, err := trigger(Request{"probability": p})
+			Expect(err).Should(MatchError(ErrUnsupportAction))
+		}
+	})
+
+	It("should fire hijack points on a share of the calls", func() {
+		g, err := (&patcher{}).Return(r, Request{
+			"func":        "github.com/u2386/go-hijack/runtime.test_for_unnamed",
+			"index":       1,
+			"val":         "io.EOF",
+			"probability": 0.5,
+			"seed":        42,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		draw := rand.New(rand.NewSource(42))
+		for i := 0; i < 100; i++ {
+			n, err := test_for_unnamed(i)
+			Expect(n).To(Equal(i))
+			if draw.Float64() < 0.5 {
+				Expect(err).To(Equal(io.EOF))
+			} else {
+				Expect(err).To(BeNil())
+			}
+		}
+	})
+
+	It("should pass calls through a panic point that does not fire", func() {
+		g, err := (&patcher{}).Panic(r, Request{
+			"func":        "github.com/u2386/go-hijack/runtime.test_for_unnamed",
+			"val":         "doom",
+			"probability": 0,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		Expect(func() { test_for_unnamed(1) }).ShouldNot(Panic())
+	})
+
+	It("should let calls that do not fire through the gate", func() {
+		g, err := (&patcher{}).Panic(r, Request{
+			"func":        "github.com/u2386/go-hijack/runtime.test_for_unnamed",
+			"val":         "doom",
+			"probability": 0,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+		Expect(g.trigger.gate).ShouldNot(BeNil())
+
+		for i := 0; i < 1000; i++ {
+			test_for_unnamed(i)
+		}
+		Expect(g.trigger.gate.passing()).To(BeEquivalentTo(maxAhead - 1000))
+		Expect(g.trigger.Stat().Calls).To(BeEquivalentTo(1000))
+
+		g, err = (&patcher{}).Return(r, Request{
+			"func":  "github.com/u2386/go-hijack/runtime.test_for_unnamed",
+			"index": 1,
+			"val":   "io.EOF",
+			"every": 3,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		var calls []int
+		for i := 1; i <= 10; i++ {
+			if _, err := test_for_unnamed(i); err != nil {
+				calls = append(calls, i)
+			}
+		}
+		Expect(calls).To(Equal([]int{3, 6, 9}))
+		Expect(g.trigger.Stat().Calls).To(BeEquivalentTo(10))
+		Expect(g.trigger.Stat().Fired).To(BeEquivalentTo(3))
+	})
+
+	fires := func(t *Trigger, n int) []int {
+		var calls []int
+		for i := 1; i <= n; i++ {
+			if t.Fire() {
+				calls = append(calls, i)
+			}
+		}
+		return calls
+	}
+
+	// gatedFires calls like fires, but behind a gate that passes calls the
+	// way gateStub does.
+	gatedFires := func(t *Trigger, n int) []int {
+		g := &gate{}
+		t.gated(g)
+
+		var calls []int
+		for i := 1; i <= n; i++ {
+			if atomic.AddInt64(&g.skip, -1) >= 0 {
+				continue
+			}
+			atomic.AddInt64(&g.skip, 1)
+			if t.Fire() {
+				calls = append(calls, i)
+			}
+		}
+		return calls
+	}
+
+	It("should fire on the same calls behind a gate", func() {
+		for _, m := range []Request{
+			{},
+			{"probability": 0},
+			{"probability": 0.3, "seed": 7},
+			{"probability": 0.001, "seed": 7},
+			{"first": 2},
+			{"every": 3},
+			{"after": 8},
+			{"between": []interface{}{2.0, 4.0}},
+			{"between": []interface{}{1.0, 20.0}, "every": 5},
+			{"after": 10, "every": 7, "probability": 0.5, "seed": 1},
+			{"first": 500, "probability": 0.01, "seed": 3},
+		} {
+			t, err := trigger(m)
+			Expect(err).ShouldNot(HaveOccurred())
+			gated, _ := trigger(m)
+			Expect(gatedFires(gated, 5000)).To(Equal(fires(t, 5000)), "%v", m)
+
+			stat := gated.Stat()
+			Expect(stat.Calls).To(BeEquivalentTo(5000), "%v", m)
+			Expect(stat).To(Equal(t.Stat()), "%v", m)
+		}
+	})
+
+	It("should fire within count windows", func() {
+		for _, c := range []struct {
+			m     Request
+			calls []int
+		}{
+			{Request{"first": 2}, []int{1, 2}},
+			{Request{"every": 3}, []int{3, 6, 9}},
+			{Request{"after": 8}, []int{9, 10}},
+			{Request{"between": []interface{}{2.0, 4.0}}, []int{2, 3, 4}},
+			{Request{"between": []interface{}{1.0, 20.0}, "every": 5}, []int{5, 10}},
+			{Request{"after": 1, "first": 3}, []int{2, 3}},
+		} {
+			t, err := trigger(c.m)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fires(t, 10)).To(Equal(c.calls), "%v", c.m)
+		}
+
+		t, _ := trigger(Request{"func": "f", "action": "panic", "first": 3})
+		fires(t, 2)
+		remaining := uint64(1)
+		Expect(t.Stat()).To(Equal(PointStat{Func: "f", Action: PANIC, Calls: 2, Fired: 2, Remaining: &remaining}))
+
+		for _, m := range []Request{
+			{"between": []interface{}{3.0}},
+			{"between": []interface{}{0.0, 2.0}},
+			{"between": []interface{}{5.0, 2.0}},
+			{"after": 5, "first": 2},
+		} {
+			_, err := trigger(m)
+			Expect(err).Should(MatchError(ErrUnsupportAction), "%v", m)
+		}
+	})
+
+	It("should call back once exhausted", func() {
+		n := 0
+		t, _ := trigger(Request{"first": 2})
+		t.whenExhausted(func() { n++ })
+		fires(t, 5)
+		Expect(n).To(Equal(1))
+
+		t.whenExhausted(func() { n++ })
+		Expect(n).To(Equal(2))
+	})
+
+	It("should release a point once its window is exhausted", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.Run(ctx)
+
+		name := "github.com/u2386/go-hijack/runtime.test_for_unnamed"
+		Expect(r.Hijack(Request{"func": name, "action": "return", "index": 1, "val": "io.EOF", "after": 1, "first": 3})).To(Succeed())
+
+		_, err := test_for_unnamed(1)
+		Expect(err).To(BeNil())
+		_, err = test_for_unnamed(2)
+		Expect(err).To(Equal(io.EOF))
+
+		remaining := uint64(1)
+		Expect(r.PointStats()).To(Equal([]PointStat{{Func: name, Action: RETURN, Calls: 2, Fired: 1, Remaining: &remaining}}))
+
+		_, err = test_for_unnamed(3)
+		Expect(err).To(Equal(io.EOF))
+		Eventually(r.Points).Should(BeEmpty())
+
+		_, err = test_for_unnamed(4)
+		Expect(err).To(BeNil())
+	})
+
+	It("should not restore a released guard", func() {
+		v := 1
+		target := reflect.ValueOf(&v).Elem()
+		g := PatchValue(target, reflect.ValueOf(2))
+		g.Release()
+		g.Restore()
+		Expect(v).To(Equal(1))
+	})
+
+	It("should refuse to count variable sets", func() {
+		_, err := (&patcher{}).SetVar(r, Request{
+			"func":  "github.com/u2386/go-hijack/runtime.test_var_retries",
+			"val":   1,
+			"first": 1,
+		})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+
+		_, err = (&patcher{}).SetVar(r, Request{
+			"func":        "github.com/u2386/go-hijack/runtime.test_var_retries",
+			"val":         1,
+			"probability": 0.5,
+		})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+	})
+
+	It("should fire within its lifetime", func() {
+		now := time.Now()
+		for _, m := range []Request{
+			{"ttl": "soon"},
+			{"ttl": "-1s"},
+			{"start_at": "tomorrow"},
+			{"end_at": now.Add(-time.Minute).Format(time.RFC3339)},
+			{"start_at": now.Add(time.Hour).Format(time.RFC3339), "ttl": "1m"},
+		} {
+			_, err := trigger(m)
+			Expect(err).Should(MatchError(ErrUnsupportAction), "%v", m)
+		}
+
+		t, err := trigger(Request{"start_at": now.Add(time.Hour).Format(time.RFC3339), "ttl": "2h"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(t.Fire()).To(BeFalse())
+		stat := t.Stat()
+		Expect(stat.Calls).To(BeZero())
+		Expect(time.ParseDuration(stat.StartsIn)).To(BeNumerically("~", time.Hour, time.Minute))
+		Expect(time.ParseDuration(stat.ExpiresIn)).To(BeNumerically("~", 2*time.Hour, time.Minute))
+
+		t, _ = trigger(Request{"ttl": "1h", "end_at": now.Add(time.Minute).Format(time.RFC3339)})
+		Expect(t.Fire()).To(BeTrue())
+		Expect(time.ParseDuration(t.Stat().ExpiresIn)).To(BeNumerically("<=", time.Minute))
+	})
+
+	It("should release points at the end of their lifetime", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.Run(ctx)
+
+		name := "github.com/u2386/go-hijack/runtime.test_for_unnamed"
+		Expect(r.Hijack(Request{"func": name, "action": "return", "index": 1, "val": "io.EOF", "ttl": "1s"})).To(Succeed())
+		Expect(r.Hijack(Request{"func": "github.com/u2386/go-hijack/runtime.test_var_retries", "action": "setvar", "val": -1, "ttl": "1s"})).To(Succeed())
+		Expect(test_var_retries).To(Equal(-1))
+
+		_, err := test_for_unnamed(1)
+		Expect(err).To(Equal(io.EOF))
+
+		// Nothing but the timers is left to release the points.
+		cancel()
+		Eventually(r.Points, 3*time.Second).Should(BeEmpty())
+		Expect(test_var_retries).NotTo(Equal(-1))
+		_, err = test_for_unnamed(1)
+		Expect(err).To(BeNil())
+	})
+
+	It("should stop the timer of a released point", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.Run(ctx)
+
+		name := "github.com/u2386/go-hijack/runtime.test_for_unnamed"
+		Expect(r.Hijack(Request{"func": name, "action": "return", "index": 1, "val": "io.EOF", "ttl": "1h"})).To(Succeed())
+		v, _ := r.M.Load(name)
+		g := v.(*Guard)
+
+		r.Release(name)
+		Expect(g.trigger.timer.Stop()).To(BeFalse())
+		_, err := test_for_unnamed(1)
+		Expect(err).To(BeNil())
+	})
+
+	It("should not expire a point hijacked again", func() {
+		name := "github.com/u2386/go-hijack/runtime.test_for_unnamed"
+		stale, fresh := &Guard{}, &Guard{}
+		r.M.Store(name, fresh)
+		r.expire(name, stale)
+		v, _ := r.M.Load(name)
+		Expect(v).To(BeIdenticalTo(fresh))
+	})
+
+	It("should refuse requests that do not decode", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.Run(ctx)
+
+		name := "github.com/u2386/go-hijack/runtime.test_for_unnamed"
+		Expect(r.Hijack(Request{"func": name, "action": "return", "index": 1, "val": "io.EOF", "first": "twice"})).Should(MatchError(ErrUnsupportAction))
+		Expect(r.Hijack(Request{"func": name, "action": "return", "index": "last", "val": "io.EOF"})).Should(MatchError(ErrUnsupportAction))
+		Expect(r.Points()).To(BeEmpty())
+
+		_, err := (&patcher{}).SetVar(r, Request{"func": "github.com/u2386/go-hijack/runtime.test_var_retries", "val": 1, "ttl": 60})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+	})
+
+	It("should refuse to schedule variable sets", func() {
+		_, err := (&patcher{}).SetVar(r, Request{
+			"func":     "github.com/u2386/go-hijack/runtime.test_var_retries",
+			"val":      1,
+			"start_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"debug/dwarf"
 	"errors"
 	"fmt"
+	"go/token"
 	"reflect"
 	"regexp"
 	"strings"
@@ -12,80 +13,344 @@ import (
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
 )
 
+type (
+	visited map[dwarf.Offset]bool
+
+	// builder rebuilds the DWARF types of one registry, tracking the types
+	// being built to break cycles.
+	builder struct {
+		*TypeRegistry
+		seen visited
+	}
+)
+
 var (
 	ErrUnsupportedType = errors.New("unsupported type")
-	typeCache          = make(map[dwarf.Offset]godwarf.Type)
-	FuncReturnRegexp   = regexp.MustCompile(`^func\(.*?\)(?P<Return>.+)$`)
+	ErrLayoutMismatch  = fmt.Errorf("%w: layout mismatch", ErrUnsupportedType)
+	errRecursive       = fmt.Errorf("%w: recursive", ErrUnsupportedType)
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	unsafePointerType  = reflect.TypeOf(unsafe.Pointer(nil))
+	sliceHeaderType    = reflect.TypeOf(struct {
+		Data     unsafe.Pointer
+		Len, Cap int
+	}{})
+	// Deprecated: FuncReturnRegexp miscounts nested func types, funcOf
+	// parses type names with funcResults.
+	FuncReturnRegexp = regexp.MustCompile(`^func\(.*?\)(?P<Return>.+)$`)
 )
 
-func structOf(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
+// fieldName exports a DWARF field name for reflect.StructOf, renaming blank
+// fields and names that collide once capitalized.
+func fieldName(name string, i int, used map[string]bool) string {
+	n := strings.Title(name)
+	if used[n] || !token.IsIdentifier(n) || !token.IsExported(n) {
+		n = fmt.Sprintf("F%d_", i)
+	}
+	used[n] = true
+	return n
+}
+
+// A renamed field keeps its DWARF name in a `dwarf` tag, so that paths and
+// object keys can still name it as it is declared.
+func fieldTag(name, exported string) reflect.StructTag {
+	if name == exported {
+		return ""
+	}
+	return reflect.StructTag(fmt.Sprintf("dwarf:%q", name))
+}
+
+// dwarfField returns the rebuilt field declared as name, or -1.
+func dwarfField(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if n, ok := t.Field(i).Tag.Lookup("dwarf"); ok && n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func padding(i int, size int64) reflect.StructField {
+	return reflect.StructField{
+		Name: fmt.Sprintf("Pad%d_", i),
+		Type: reflect.ArrayOf(int(size), reflect.TypeOf(byte(0))),
+	}
+}
+
+func align(off int64, a int) int64 {
+	return (off + int64(a) - 1) &^ (int64(a) - 1)
+}
+
+// structOf rebuilds a struct with every field at its DWARF offset, inserting
+// padding where the reflect layout would place a field too early. It fails
+// with ErrLayoutMismatch when the result still differs from the DWARF.
+func (b *builder) structOf(typ godwarf.Type) (reflect.Type, error) {
 	t := typ.(*godwarf.StructType)
-	var fields []reflect.StructField
-	for _, field := range t.Field {
-		rt, err := MakeType(field.Type, dw)
+	if b.seen[t.Offset] {
+		return nil, fmt.Errorf("%w %s", errRecursive, t.Name)
+	}
+	b.seen[t.Offset] = true
+	defer delete(b.seen, t.Offset)
+
+	var (
+		fields  []reflect.StructField
+		indices []int
+		used    = make(map[string]bool)
+		off     int64
+	)
+	for i, field := range t.Field {
+		rt, err := b.makeType(field.Type)
 		if err != nil {
 			return nil, err
 		}
+
+		if gap := field.ByteOffset - align(off, rt.Align()); gap > 0 {
+			fields = append(fields, padding(i, field.ByteOffset-off))
+			off = field.ByteOffset
+		}
+
+		indices = append(indices, len(fields))
+		name := fieldName(field.Name, i, used)
 		fields = append(fields, reflect.StructField{
-			Name: strings.Title(field.Name),
-			Type: rt,
+			Name:      name,
+			Type:      rt,
+			Tag:       fieldTag(field.Name, name),
+			Anonymous: field.Embedded && rt.Kind() == reflect.Struct && rt.NumMethod() == 0,
 		})
+		off = align(off, rt.Align()) + int64(rt.Size())
+	}
+	if align(off, maxAlign(fields)) < t.ByteSize {
+		fields = append(fields, padding(len(t.Field), t.ByteSize-off))
+	}
+
+	st := reflect.StructOf(fields)
+	if st.Size() != uintptr(t.ByteSize) {
+		return nil, fmt.Errorf("%w: %s is %d bytes, want %d", ErrLayoutMismatch, t.Name, st.Size(), t.ByteSize)
+	}
+	for i, field := range t.Field {
+		if got := st.Field(indices[i]).Offset; got != uintptr(field.ByteOffset) {
+			return nil, fmt.Errorf("%w: %s.%s at %d, want %d", ErrLayoutMismatch, t.Name, field.Name, got, field.ByteOffset)
+		}
 	}
-	return reflect.StructOf(fields), nil
+	return st, nil
 }
 
-func mapOf(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
+func maxAlign(fields []reflect.StructField) int {
+	a := 1
+	for _, f := range fields {
+		if f.Type.Align() > a {
+			a = f.Type.Align()
+		}
+	}
+	return a
+}
+
+func (b *builder) mapOf(typ godwarf.Type) (reflect.Type, error) {
 	t := typ.(*godwarf.MapType)
 
-	kt, err := MakeType(t.KeyType, dw)
+	kt, err := b.makeType(t.KeyType)
 	if err != nil {
 		return nil, err
 	}
-	vt, err := MakeType(t.ElemType, dw)
+	vt, err := b.makeType(t.ElemType)
 	if err != nil {
 		return nil, err
 	}
 	return reflect.MapOf(kt, vt), nil
 }
 
-func sliceOf(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
+func (b *builder) sliceOf(typ godwarf.Type) (reflect.Type, error) {
 	t := typ.(*godwarf.SliceType)
-	et, err := MakeType(t.ElemType, dw)
+	et, err := b.makeType(t.ElemType)
 	if err != nil {
 		return nil, err
 	}
 	return reflect.SliceOf(et), nil
 }
 
-func chanOf(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
+func (b *builder) arrayOf(typ godwarf.Type) (reflect.Type, error) {
+	t := typ.(*godwarf.ArrayType)
+	if t.Count < 0 {
+		return nil, fmt.Errorf("%w: incomplete array %s", ErrUnsupportedType, t.String())
+	}
+	et, err := b.makeType(t.Type)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ArrayOf(int(t.Count), et), nil
+}
+
+var (
+	signedTypes   = map[int64]reflect.Type{1: reflect.TypeOf(int8(0)), 2: reflect.TypeOf(int16(0)), 4: reflect.TypeOf(int32(0)), 8: reflect.TypeOf(int64(0))}
+	unsignedTypes = map[int64]reflect.Type{1: reflect.TypeOf(uint8(0)), 2: reflect.TypeOf(uint16(0)), 4: reflect.TypeOf(uint32(0)), 8: reflect.TypeOf(uint64(0))}
+	floatTypes    = map[int64]reflect.Type{4: reflect.TypeOf(float32(0)), 8: reflect.TypeOf(float64(0))}
+	complexTypes  = map[int64]reflect.Type{8: reflect.TypeOf(complex64(0)), 16: reflect.TypeOf(complex128(0))}
+)
+
+// basicOf maps a base type by its DWARF encoding and byte size. byte and rune
+// are aliases and never show up under their own names, whereas int, uint and
+// uintptr share their size with a sized kind and are told apart by name.
+func basicOf(typ godwarf.Type) (reflect.Type, error) {
+	var types map[int64]reflect.Type
+	switch typ.(type) {
+	case *godwarf.IntType, *godwarf.CharType:
+		if typ.Common().Name == "int" {
+			return reflect.TypeOf(0), nil
+		}
+		types = signedTypes
+	case *godwarf.UintType, *godwarf.UcharType:
+		switch typ.Common().Name {
+		case "uint":
+			return reflect.TypeOf(uint(0)), nil
+		case "uintptr":
+			return reflect.TypeOf(uintptr(0)), nil
+		}
+		types = unsignedTypes
+	case *godwarf.FloatType:
+		types = floatTypes
+	case *godwarf.ComplexType:
+		types = complexTypes
+	}
+
+	if rt, ok := types[typ.Size()]; ok {
+		return rt, nil
+	}
+	return nil, fmt.Errorf("%w: %s of %d bytes", ErrUnsupportedType, typ.String(), typ.Size())
+}
+
+func (b *builder) chanOf(typ godwarf.Type) (reflect.Type, error) {
 	t := typ.(*godwarf.ChanType)
-	et, err := MakeType(t.ElemType, dw)
+	et, err := b.makeType(t.ElemType)
 	if err != nil {
 		return nil, err
 	}
-	return reflect.ChanOf(reflect.BothDir, et), nil
+	return reflect.ChanOf(chanDir(t.Name), et), nil
+}
+
+// chanDir reads the direction of a channel type from its name, the way
+// reflect spells it.
+func chanDir(name string) reflect.ChanDir {
+	switch {
+	case strings.HasPrefix(name, "<-chan "):
+		return reflect.RecvDir
+	case strings.HasPrefix(name, "chan<- "):
+		return reflect.SendDir
+	}
+	return reflect.BothDir
+}
+
+// funcResults counts the results of a function type from its name, e.g. 2 for
+// `func(func() int) (a, b int)`. The parameter list is skipped by matching
+// parentheses, so func types nested in parameters or results do not confuse
+// it, and results are separated by commas outside any brackets.
+func funcResults(name string) int {
+	if !strings.HasPrefix(name, "func(") {
+		return 0
+	}
+
+	depth, i := 0, len("func")
+	for ; i < len(name); i++ {
+		if name[i] == '(' {
+			depth++
+		} else if name[i] == ')' {
+			if depth--; depth == 0 {
+				break
+			}
+		}
+	}
+	if i == len(name) {
+		return 0
+	}
+	results := strings.TrimSpace(name[i+1:])
+	if results == "" {
+		return 0
+	}
+	if results[0] != '(' {
+		return 1
+	}
+
+	count := 1
+	depth = 0
+	for _, c := range results {
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 1 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// funcTypeResults reads the result count of a function type. Newer linkers
+// mark results with DW_AT_variable_parameter and describe them by value. Older
+// ones describe them as pointers without any mark, and are left to the caller.
+// Function types with a runtime type never get here, as realType returns it.
+func (b *builder) funcTypeResults(t *godwarf.FuncType) (int, bool) {
+	rdr := b.dwarf.Reader()
+	rdr.Seek(t.Offset)
+	e, err := rdr.Next()
+	if err != nil || e == nil {
+		return 0, false
+	}
+
+	marked := 0
+	for e.Children {
+		child, err := rdr.Next()
+		if err != nil || child == nil || child.Tag == 0 {
+			break
+		}
+		if v, _ := child.Val(dwarf.AttrVarParam).(bool); v {
+			marked++
+		}
+		if child.Children {
+			rdr.SkipChildren()
+		}
+	}
+	return marked, marked > 0
 }
 
-func funcOf(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
+func (b *builder) funcOf(typ godwarf.Type) (reflect.Type, error) {
 	t := typ.(*godwarf.FuncType)
 
-	// FIXME: We cannot distinguish parameters and return values from FuncType, so
-	// we use regex to count function returns.
-	// See issue: https://github.com/golang/go/issues/48812
-	var count int
-	if m := FuncReturnRegexp.FindStringSubmatch(t.Name); m != nil {
-		count = len(strings.Split(m[1], ","))
+	// A variadic function type lists the slice of its last parameter and then
+	// a `...` marker.
+	var (
+		params   []godwarf.Type
+		variadic bool
+	)
+	for _, param := range t.ParamType {
+		if _, ok := param.(*godwarf.DotDotDotType); ok {
+			variadic = true
+			continue
+		}
+		params = append(params, param)
 	}
 
-	pt := t.ParamType[:len(t.ParamType)-count]
-	rt := t.ParamType[len(pt):]
+	count, ok := b.funcTypeResults(t)
+	indirect := false
+	if !ok {
+		// Results of old linkers are not marked, see
+		// https://github.com/golang/go/issues/48812, and are counted from
+		// the type name instead.
+		count, indirect = funcResults(t.Name), true
+	}
+	if count > len(params) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, t.Name)
+	}
+
+	pt := params[:len(params)-count]
+	rt := params[len(pt):]
 
 	var (
 		in  []reflect.Type
 		out []reflect.Type
 	)
 	for _, param := range pt {
-		v, err := MakeType(param, dw)
+		v, err := b.makeType(param)
 		if err != nil {
 			return nil, err
 		}
@@ -93,111 +358,155 @@ func funcOf(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
 	}
 
 	for _, ret := range rt {
-		v, err := MakeType(ret.(*godwarf.PtrType).Type, dw)
+		if p, ok := ret.(*godwarf.PtrType); ok && indirect {
+			ret = p.Type
+		}
+		v, err := b.makeType(ret)
 		if err != nil {
 			return nil, err
 		}
 		out = append(out, v)
 	}
 
-	return reflect.FuncOf(in, out, false), nil
+	return reflect.FuncOf(in, out, variadic && len(in) > 0), nil
 }
 
+// MakeType rebuilds a DWARF type as a reflect type. Runtime memoizes it in
+// its TypeRegistry, which also knows the runtime types of the running binary;
+// on its own, MakeType rebuilds every type as if dw came from another binary.
 func MakeType(typ godwarf.Type, dw *dwarf.Data) (reflect.Type, error) {
+	return NewTypeRegistry(dw).Type(typ)
+}
+
+func (t *TypeRegistry) makeType(typ godwarf.Type) (rt reflect.Type, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			rt, err = nil, fmt.Errorf("%w: %s: %v", ErrUnsupportedType, typ.String(), e)
+		}
+	}()
+	b := &builder{TypeRegistry: t, seen: make(visited)}
+	return b.makeType(typ)
+}
+
+// opaque replaces a reference closing a cycle by a placeholder of the same
+// layout, which keeps the layout of the enclosing struct, e.g. *http.Request
+// and *http.Response pointing at each other, or a tree node holding a slice of
+// nodes. Other errors are returned as they are.
+func opaque(err error, placeholder reflect.Type) (reflect.Type, error) {
+	if errors.Is(err, errRecursive) {
+		return placeholder, nil
+	}
+	return nil, err
+}
+
+func (b *builder) makeType(typ godwarf.Type) (reflect.Type, error) {
+	if rt := b.realType(typ); rt != nil {
+		return rt, nil
+	}
+
 	switch t := typ.(type) {
 	case *godwarf.TypedefType:
 		if t.Name == "error" {
-			return reflect.TypeOf((*error)(nil)).Elem(), nil
+			return errorType, nil
 		}
-		return MakeType(t.Type, dw)
+		return b.makeType(t.Type)
 
 	case *godwarf.PtrType:
 		if t.Name == "unsafe.Pointer" {
-			var ifunc interface{} = (func())(nil)
-			return reflect.TypeOf(unsafe.Pointer(&ifunc)), nil
+			return unsafePointerType, nil
 		}
-		rt, err := MakeType(t.Type, dw)
+		rt, err := b.makeType(t.Type)
 		if err != nil {
-			return nil, err
+			return opaque(err, unsafePointerType)
 		}
 		return reflect.PtrTo(rt), nil
 
 	case *godwarf.StructType:
-		return structOf(t, dw)
+		return b.structOf(t)
 
 	case *godwarf.StringType:
 		return reflect.TypeOf(""), nil
 
-	case *godwarf.IntType:
-		return reflect.TypeOf(0), nil
+	case *godwarf.IntType, *godwarf.UintType, *godwarf.CharType, *godwarf.UcharType, *godwarf.FloatType, *godwarf.ComplexType:
+		return basicOf(t)
 
 	case *godwarf.BoolType:
 		return reflect.TypeOf(false), nil
 
 	case *godwarf.MapType:
-		return mapOf(t, dw)
+		rt, err := b.mapOf(t)
+		if err != nil {
+			return opaque(err, unsafePointerType)
+		}
+		return rt, nil
 
 	case *godwarf.SliceType:
-		return sliceOf(t, dw)
+		rt, err := b.sliceOf(t)
+		if err != nil {
+			return opaque(err, sliceHeaderType)
+		}
+		return rt, nil
 
-	case *godwarf.UintType:
-		return reflect.TypeOf(uint64(0)), nil
+	case *godwarf.ArrayType:
+		return b.arrayOf(t)
 
 	case *godwarf.FuncType:
-		return funcOf(t, dw)
+		rt, err := b.funcOf(t)
+		if err != nil {
+			return opaque(err, unsafePointerType)
+		}
+		return rt, nil
 
 	case *godwarf.InterfaceType:
-		return reflect.TypeOf((*interface{})(nil)).Elem(), nil
+		return ifaceOf(t)
 
 	case *godwarf.ChanType:
-		return chanOf(t, dw)
+		rt, err := b.chanOf(t)
+		if err != nil {
+			return opaque(err, unsafePointerType)
+		}
+		return rt, nil
 
 	default:
 		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, t.String())
 	}
 }
 
-func MakeFunc(tree *godwarf.Tree, dw *dwarf.Data) (reflect.Type, error) {
-	var (
-		in  []reflect.Type
-		out []reflect.Type
+type formalParameter struct {
+	Name   string
+	Type   godwarf.Type
+	Return bool
+}
 
+func signatureOf(tree *godwarf.Tree, params []formalParameter) string {
+	var (
 		args    []string
 		returns []string
 	)
-
-	for _, node := range tree.Children {
-		if node.Tag != dwarf.TagFormalParameter {
-			continue
-		}
-
-		typ, err := node.Type(dw, int(node.Offset), typeCache)
-		if err != nil {
-			return nil, err
-		}
-
-		param, err := MakeType(typ, dw)
-		if err != nil {
-			return nil, err
-		}
-
-		if node.Entry.Val(dwarf.AttrVarParam).(bool) {
-			out = append(out, param)
-			returns = append(returns, fmt.Sprintf("%s %s", node.Entry.Val(dwarf.AttrName), typ.String()))
+	for _, param := range params {
+		if param.Return {
+			returns = append(returns, fmt.Sprintf("%s %s", param.Name, param.Type.String()))
 		} else {
-			in = append(in, param)
-			args = append(args, fmt.Sprintf("%s %s", node.Entry.Val(dwarf.AttrName), typ.String()))
+			args = append(args, fmt.Sprintf("%s %s", param.Name, param.Type.String()))
 		}
 	}
 
+	name, _ := tree.Entry.Val(dwarf.AttrName).(string)
+
 	var sb strings.Builder
-	sb.WriteString(tree.Entry.Val(dwarf.AttrName).(string) + "(" + strings.Join(args, ", ") + ")")
+	sb.WriteString(name + "(" + strings.Join(args, ", ") + ")")
 	if len(returns) > 0 {
 		sb.WriteString(" (")
 		sb.WriteString(strings.Join(returns, ", "))
 		sb.WriteRune(')')
 	}
-	debug("%s", sb.String())
+	return sb.String()
+}
 
-	return reflect.FuncOf(in, out, false), nil
+func FuncSignature(tree *godwarf.Tree, dw *dwarf.Data) (string, error) {
+	return NewTypeRegistry(dw).FuncSignature(tree)
+}
+
+func MakeFunc(tree *godwarf.Tree, dw *dwarf.Data) (reflect.Type, error) {
+	return NewTypeRegistry(dw).Func(tree)
 }
@@ -0,0 +1,356 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:noinline
+func test_for_nested_callback(f func(func() (int, int)) int) int { return f(nil) }
+
+var _ = test_for_nested_callback(func(func() (int, int)) int { return 0 })
+
+// sampleSignatures lists the functions of test/testdata/sample.go together
+// with the signature MakeFunc has to reconstruct for them.
+var sampleSignatures = map[string]interface{}{
+	"main.test_single_byte":    func(byte) {},
+	"main.test_single_rune":    func(rune) {},
+	"main.test_single_string":  func(string) {},
+	"main.test_single_bool":    func(bool) {},
+	"main.test_single_int":     func(int) {},
+	"main.test_single_int8":    func(int8) {},
+	"main.test_single_int16":   func(int16) {},
+	"main.test_single_int32":   func(int32) {},
+	"main.test_single_int64":   func(int64) {},
+	"main.test_single_uint":    func(uint) {},
+	"main.test_single_uint8":   func(uint8) {},
+	"main.test_single_uint16":  func(uint16) {},
+	"main.test_single_uint32":  func(uint32) {},
+	"main.test_single_uint64":  func(uint64) {},
+	"main.test_single_float32": func(float32) {},
+	"main.test_single_float64": func(float64) {},
+
+	"main.test_combined_byte":   func(byte, byte, float32) {},
+	"main.test_combined_rune":   func(byte, rune, float32) {},
+	"main.test_combined_string": func(byte, string, float32) {},
+	"main.test_combined_bool":   func(byte, bool, float32) {},
+	"main.test_combined_int":    func(byte, int, float32) {},
+	"main.test_combined_int8":   func(byte, int8, float32) {},
+	"main.test_combined_int16":  func(byte, int16, float32) {},
+	"main.test_combined_int32":  func(byte, int32, float32) {},
+	"main.test_combined_int64":  func(byte, int64, float32) {},
+	"main.test_combined_uint":   func(byte, uint, float32) {},
+	"main.test_combined_uint8":  func(byte, uint8, float32) {},
+	"main.test_combined_uint16": func(byte, uint16, float32) {},
+	"main.test_combined_uint32": func(byte, uint32, float32) {},
+	"main.test_combined_uint64": func(byte, uint64, float32) {},
+
+	"main.test_byte_array":   func([2]byte) {},
+	"main.test_rune_array":   func([2]rune) {},
+	"main.test_string_array": func([2]string) {},
+	"main.test_bool_array":   func([2]bool) {},
+	"main.test_int_array":    func([2]int) {},
+	"main.test_int8_array":   func([2]int8) {},
+	"main.test_int16_array":  func([2]int16) {},
+	"main.test_int32_array":  func([2]int32) {},
+	"main.test_int64_array":  func([2]int64) {},
+	"main.test_uint_array":   func([2]uint) {},
+	"main.test_uint8_array":  func([2]uint8) {},
+	"main.test_uint16_array": func([2]uint16) {},
+	"main.test_uint32_array": func([2]uint32) {},
+	"main.test_uint64_array": func([2]uint64) {},
+
+	"main.test_uint64_slice":      func([]uint64) {},
+	"main.test_interface":         func(interface{}) {},
+	"main.test_vardic":            func([]string) {},
+	"main.test_single_return":     func() string { return "" },
+	"main.test_multiple_returns":  func() (int, error) { return 0, nil },
+	"main.(*simpleStruct).String": nil,
+}
+
+//go:noinline
+func test_for_complex(c64 complex64, c128 complex128, p uintptr) complex128 {
+	return complex128(c64) + c128 + complex(float64(p), 0)
+}
+
+var _ = test_for_complex(0, 0, 0)
+
+type test_point struct{ X, Y int32 }
+
+//go:noinline
+func test_for_arrays(id [16]byte, grid [2][3]int, points [2]test_point) [2]int {
+	return [2]int{int(id[0]), grid[1][2] + int(points[1].Y)}
+}
+
+var _ = test_for_arrays([16]byte{}, [2][3]int{}, [2]test_point{})
+
+// buildSample compiles sample.go into dir with the flags of the running tests.
+func buildSample(dir string) (string, error) {
+	out := filepath.Join(dir, "sample")
+	cmd := exec.Command("go", "build", "-gcflags=-l -N", "-ldflags=-w=0 -s=0", "-o", out, "../test/testdata/sample.go")
+	cmd.Stderr = GinkgoWriter
+	return out, cmd.Run()
+}
+
+var _ = Describe("Test Make Type of Basic Kinds", func() {
+	It("should reconstruct the signatures of sample.go", func() {
+		if _, err := exec.LookPath("go"); err != nil {
+			Skip("go is not installed")
+		}
+		dir, err := os.MkdirTemp("", "go-hijack-sample")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		bin, err := buildSample(dir)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		ef, err := elf.Open(bin)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer ef.Close()
+
+		var (
+			dw    *dwarf.Data
+			trees map[string]*godwarf.Tree
+		)
+		dw, err = ef.DWARF()
+		Expect(err).ShouldNot(HaveOccurred())
+		trees, err = DwarfTree(dw)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		for name, fn := range sampleSignatures {
+			tree, ok := trees[name]
+			Expect(ok).To(BeTrue(), name)
+
+			ft, err := MakeFunc(tree, dw)
+			Expect(err).ShouldNot(HaveOccurred(), name)
+			if fn != nil {
+				Expect(ft).To(Equal(reflect.TypeOf(fn)), name)
+			}
+		}
+	})
+
+	It("should reconstruct complex and uintptr", func() {
+		r, _ := New(pid)
+		ft, err := r.types.Func(r.dwarftrees["github.com/u2386/go-hijack/runtime.test_for_complex"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft).To(Equal(reflect.TypeOf(test_for_complex)))
+	})
+})
+
+var _ = Describe("Test Make Type of Arrays", func() {
+	const name = "github.com/u2386/go-hijack/runtime.test_for_arrays"
+
+	It("should reconstruct nested arrays and arrays of structs", func() {
+		r, _ := New(pid)
+		ft, err := r.types.Func(r.dwarftrees[name])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.In(0)).To(Equal(reflect.TypeOf([16]byte{})))
+		Expect(ft.In(1)).To(Equal(reflect.TypeOf([2][3]int{})))
+		Expect(ft.In(2).Kind()).To(Equal(reflect.Array))
+		Expect(ft.In(2).Elem().Size()).To(Equal(reflect.TypeOf(test_point{}).Size()))
+		Expect(ft.Out(0)).To(Equal(reflect.TypeOf([2]int{})))
+	})
+
+	It("should decode hex strings and JSON arrays", func() {
+		v, err := Decode(reflect.TypeOf([4]byte{}), "0xdeadbeef")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Interface()).To(Equal([4]byte{0xde, 0xad, 0xbe, 0xef}))
+
+		_, err = Decode(reflect.TypeOf([4]byte{}), "dead")
+		Expect(err).Should(MatchError(ErrDecode))
+		_, err = Decode(reflect.TypeOf([2]int{}), "dead")
+		Expect(err).Should(MatchError(ErrDecode))
+
+		v, err = Decode(reflect.TypeOf([2][2]int{}), []interface{}{[]interface{}{1.0, 2.0}, []interface{}{3.0, 4.0}})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Interface()).To(Equal([2][2]int{{1, 2}, {3, 4}}))
+	})
+
+	Context("Test Hijack", func() {
+		var (
+			r *Runtime
+			g *Guard
+		)
+
+		BeforeEach(func() {
+			r, _ = New(pid)
+		})
+
+		AfterEach(func() {
+			if g != nil {
+				g.Unpatch()
+			}
+		})
+
+		It("should set an array argument from a hex string", func() {
+			var err error
+			g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 0, "val": "ff000000000000000000000000000000"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(test_for_arrays([16]byte{}, [2][3]int{}, [2]test_point{})[0]).To(Equal(0xff))
+		})
+
+		It("should return an array from a JSON array", func() {
+			var err error
+			g, err = (&patcher{}).Return(r, map[string]interface{}{"func": name, "index": 0, "val": []interface{}{7.0, 9.0}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(test_for_arrays([16]byte{}, [2][3]int{}, [2]test_point{})).To(Equal([2]int{7, 9}))
+		})
+
+		It("should refuse values of the wrong length", func() {
+			var err error
+			g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 0, "val": "ff"})
+			Expect(err).Should(MatchError(ErrDecode))
+		})
+	})
+})
+
+type (
+	test_embedded struct {
+		id int16
+	}
+
+	test_layout struct {
+		flag bool
+		_    [3]byte
+		a    int32
+		A    int64
+		test_embedded
+		_    int8
+		tail uint16
+	}
+)
+
+//go:noinline
+func test_for_layout(l test_layout) int32 { return l.a }
+
+var _ = test_for_layout(test_layout{})
+
+var _ = Describe("Test Make Type of Struct Layout", func() {
+	It("should keep offsets and size", func() {
+		// DWARF not read by New has no runtime types and is rebuilt.
+		ef, _ := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+		dw, _ := ef.DWARF()
+		trees, _ := DwarfTree(dw)
+		ft, err := MakeFunc(trees["github.com/u2386/go-hijack/runtime.test_for_layout"], dw)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.In(0)).ShouldNot(Equal(reflect.TypeOf(test_layout{})))
+
+		want, got := reflect.TypeOf(test_layout{}), ft.In(0)
+		Expect(got.Size()).To(Equal(want.Size()))
+		Expect(got.NumField()).To(Equal(want.NumField()))
+		for i := 0; i < want.NumField(); i++ {
+			Expect(got.Field(i).Offset).To(Equal(want.Field(i).Offset), want.Field(i).Name)
+		}
+		Expect(got.Field(4).Anonymous).To(BeTrue())
+		_, promoted := got.FieldByName("Id")
+		Expect(promoted).To(BeTrue())
+
+		fn := reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+			return []reflect.Value{args[0].Field(3).Convert(reflect.TypeOf(int32(0)))}
+		})
+		g := Patch(test_for_layout, fn.Interface())
+		defer g.Unpatch()
+		Expect(test_for_layout(test_layout{A: 42})).To(BeEquivalentTo(42))
+	})
+
+	It("should insert padding", func() {
+		fields := []reflect.StructField{padding(0, 3), {Name: "A", Type: reflect.TypeOf(int32(0))}}
+		Expect(reflect.StructOf(fields).Field(1).Offset).To(BeEquivalentTo(4))
+		Expect(align(5, 4)).To(BeEquivalentTo(8))
+		Expect(align(8, 8)).To(BeEquivalentTo(8))
+	})
+
+	It("should rename blank and colliding fields", func() {
+		used := make(map[string]bool)
+		Expect(fieldName("a", 0, used)).To(Equal("A"))
+		Expect(fieldName("A", 1, used)).To(Equal("F1_"))
+		Expect(fieldName("_", 2, used)).To(Equal("F2_"))
+		Expect(fieldName("_panic", 3, used)).To(Equal("F3_"))
+	})
+
+	It("should address renamed fields by their declared names", func() {
+		ef, _ := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+		dw, _ := ef.DWARF()
+		trees, _ := DwarfTree(dw)
+		ft, err := MakeFunc(trees["github.com/u2386/go-hijack/runtime.test_for_layout"], dw)
+		Expect(err).ShouldNot(HaveOccurred())
+		typ := ft.In(0)
+
+		p, err := compilePath(typ, "A")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(p.typ).To(Equal(reflect.TypeOf(int64(0))))
+		p, err = compilePath(typ, "a")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(p.typ).To(Equal(reflect.TypeOf(int32(0))))
+
+		v, err := Decode(typ, map[string]interface{}{"a": 1, "A": 2})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Field(dwarfField(typ, "a")).Int()).To(BeEquivalentTo(1))
+		Expect(v.Field(dwarfField(typ, "A")).Int()).To(BeEquivalentTo(2))
+	})
+})
+
+var _ = Describe("Test Make Type of Runtime Types", func() {
+	It("should resolve named types of the running binary", func() {
+		r, _ := New(pid)
+		ft, err := r.types.Func(r.dwarftrees["github.com/u2386/go-hijack/runtime.test_for_layout"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft).To(Equal(reflect.TypeOf(test_for_layout)))
+
+		ft, err = r.types.Func(r.dwarftrees["github.com/u2386/go-hijack/runtime.test_struct_argument"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.In(0)).To(Equal(reflect.TypeOf(&http.Request{})))
+		_, ok := ft.In(0).MethodByName("Context")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should return named types callers can assert", func() {
+		r, _ := New(pid)
+		tree := r.dwarftrees["github.com/u2386/go-hijack/runtime.doomer"]
+		ft, err := r.types.Func(tree)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.Out(0)).To(Equal(reflect.TypeOf(time.Time{})))
+
+		var v interface{} = reflect.Zero(ft.Out(0)).Interface()
+		_, ok := v.(time.Time)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should count the results of callbacks", func() {
+		r, _ := New(pid)
+		var ft reflect.Type
+		for name, tree := range r.dwarftrees {
+			if strings.HasSuffix(name, "test_for_nested_callback") {
+				var err error
+				ft, err = r.types.Func(tree)
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+		}
+		Expect(ft).ShouldNot(BeNil())
+		Expect(ft.In(0)).To(Equal(reflect.TypeOf(func(func() (int, int)) int { return 0 })))
+	})
+
+	It("should ignore foreign and invalid addresses", func() {
+		r, _ := New(pid)
+		Expect((*module)(nil).runtimeType(8)).To(BeZero())
+		Expect(r.types.module.runtimeType(0)).To(BeZero())
+		Expect(r.types.module.runtimeType(1 << 62)).To(BeZero())
+		Expect(r.types.module.runtimeType(8)).ShouldNot(BeZero())
+
+		other, _ := New(pid)
+		Expect(other.types.module).ShouldNot(BeIdenticalTo(r.types.module))
+		Expect(NewTypeRegistry(r.dwarf).module).To(BeNil())
+	})
+})
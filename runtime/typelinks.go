@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	"debug/elf"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+//go:linkname typesByString reflect.typesByString
+func typesByString(s string) []unsafe.Pointer
+
+// module is the type section of the running binary, which holds every type
+// descriptor referenced by moduledata.typelinks.
+type module struct {
+	start, end uint64
+}
+
+// selfModule returns the type section of the running binary, or nil if its
+// bounds are not among symbols.
+func selfModule(symbols map[string]elf.Symbol) *module {
+	start, ok := symbols["runtime.types"]
+	end, ok2 := symbols["runtime.etypes"]
+	if !ok || !ok2 {
+		return nil
+	}
+	return &module{start: start.Value, end: end.Value}
+}
+
+// runtimeType converts DW_AT_go_runtime_type into the address of the type
+// descriptor. Older linkers store the address itself, newer ones an offset
+// from runtime.types, which is told apart by being below the section start.
+// It returns 0 for a nil module, which DWARF of another binary has, and for
+// addresses outside the type section.
+func (m *module) runtimeType(attr uint64) uint64 {
+	if m == nil || attr == 0 {
+		return 0
+	}
+	if attr < m.start {
+		attr += m.start
+	}
+	if attr >= m.end {
+		return 0
+	}
+	return attr
+}
+
+// typeAt turns the address of a type descriptor into a reflect.Type by
+// building an empty interface holding that type.
+func typeAt(addr uint64) reflect.Type {
+	var e struct {
+		typ  uintptr
+		data unsafe.Pointer
+	}
+	e.typ = uintptr(addr)
+	return reflect.TypeOf(*(*interface{})(unsafe.Pointer(&e)))
+}
+
+// realType returns the type the compiler emitted for typ, so that named types
+// keep their identity and methods. It returns nil when typ has no runtime
+// type, e.g. in a foreign binary, or its size disagrees with the DWARF.
+func (b *builder) realType(typ godwarf.Type) reflect.Type {
+	if b.module == nil {
+		return nil
+	}
+	rdr := b.dwarf.Reader()
+	rdr.Seek(typ.Common().Offset)
+	e, err := rdr.Next()
+	if err != nil || e == nil {
+		return nil
+	}
+	attr, _ := e.Val(godwarf.AttrGoRuntimeType).(uint64)
+	addr := b.module.runtimeType(attr)
+	if addr == 0 {
+		return nil
+	}
+
+	rt := typeAt(addr)
+	if rt == nil || int64(rt.Size()) != typ.Size() {
+		return nil
+	}
+	return rt
+}
+
+// typeByName looks a named type up in the typelinks of the running binary.
+// Named types are not linked themselves, so the pointer to it is searched.
+func typeByName(name string) reflect.Type {
+	for _, addr := range typesByString("*" + name) {
+		if rt := typeAt(uint64(uintptr(addr))); rt.Kind() == reflect.Ptr && rt.Elem().String() == name {
+			return rt.Elem()
+		}
+	}
+	return nil
+}
+
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// ifaceOf reconstructs an interface without a runtime type. Empty interfaces
+// are eface {type, data}, but non-empty ones iface {itab, data}, so they must
+// be typed with their method set and are refused when it is unknown.
+func ifaceOf(t *godwarf.InterfaceType) (reflect.Type, error) {
+	if st, ok := t.Type.(*godwarf.StructType); ok && st.Name == "runtime.eface" {
+		return emptyInterfaceType, nil
+	}
+	if t.Name == "error" {
+		return errorType, nil
+	}
+	if rt := typeByName(t.Name); rt != nil && rt.Kind() == reflect.Interface {
+		return rt, nil
+	}
+	return nil, fmt.Errorf("%w: interface %s has no runtime type", ErrUnsupportedType, t.Name)
+}
@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type test_ctx_key struct{}
+
+//go:noinline
+func test_for_ifaces(ctx context.Context, r io.Reader, v interface{}) string {
+	b, _ := io.ReadAll(r)
+	return fmt.Sprint(ctx.Value(test_ctx_key{}), string(b), v)
+}
+
+var _ = test_for_ifaces(context.Background(), strings.NewReader(""), nil)
+
+var _ = Describe("Test Interface Types", func() {
+	const name = "github.com/u2386/go-hijack/runtime.test_for_ifaces"
+
+	It("should look named types up in typelinks", func() {
+		Expect(typeByName("context.Context")).To(Equal(reflect.TypeOf((*context.Context)(nil)).Elem()))
+		Expect(typeByName("no.Such")).To(BeNil())
+	})
+
+	It("should reconstruct interfaces without runtime types", func() {
+		ef, _ := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+		dw, _ := ef.DWARF()
+		trees, _ := DwarfTree(dw)
+
+		ft, err := MakeFunc(trees[name], dw)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft).To(Equal(reflect.TypeOf(test_for_ifaces)))
+
+		_, err = MakeFunc(trees["github.com/u2386/go-hijack/runtime.test_for_interface_arg"], dw)
+		Expect(err).Should(MatchError(ErrUnsupportedType))
+	})
+
+	It("should pass interfaces through hooks", func() {
+		r, _ := New(pid)
+		g, err := (&patcher{}).Delay(r, map[string]interface{}{"func": name, "val": 10})
+		Expect(err).ShouldNot(HaveOccurred())
+		defer g.Unpatch()
+
+		ctx := context.WithValue(context.Background(), test_ctx_key{}, "tenant")
+		t0 := time.Now()
+		Expect(test_for_ifaces(ctx, strings.NewReader("body"), 1)).To(Equal("tenantbody1"))
+		Expect(time.Since(t0)).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+})
@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+	"github.com/mitchellh/mapstructure"
+)
+
+type Variable struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Address uint64      `json:"address"`
+	Value   interface{} `json:"value"`
+}
+
+var (
+	ErrVarNotFound = errors.New("variable not found")
+	ErrUnsafeValue = errors.New("unsafe value")
+)
+
+func (r *Runtime) vars() map[string]*dwarf.Entry {
+	r.varOnce.Do(func() {
+		vs, err := DwarfVars(r.dwarf)
+		if err != nil {
+			debug("read variables:%s", err)
+		}
+		r.variables = vs
+	})
+	return r.variables
+}
+
+// lookupVar returns the DWARF type and static address of a package-level
+// variable. Only variables located by a plain DW_OP_addr are supported.
+func (r *Runtime) lookupVar(name string) (godwarf.Type, uintptr, error) {
+	entry, ok := r.vars()[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrVarNotFound, name)
+	}
+
+	loc, ok := entry.Val(dwarf.AttrLocation).([]byte)
+	if !ok || len(loc) != 9 || op.Opcode(loc[0]) != op.DW_OP_addr {
+		return nil, 0, fmt.Errorf("%w: %s has no static address", ErrVarNotFound, name)
+	}
+	addr := uintptr(binary.LittleEndian.Uint64(loc[1:]))
+
+	off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s has no type", ErrVarNotFound, name)
+	}
+	typ, err := r.types.ReadType(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	return typ, addr, nil
+}
+
+// varValue maps a package-level variable onto its rebuilt reflect type, so
+// that the returned value reads and writes the live variable.
+func (r *Runtime) varValue(name string) (godwarf.Type, reflect.Value, error) {
+	typ, addr, err := r.lookupVar(name)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+
+	rt, err := r.types.Type(typ)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+	if uintptr(typ.Size()) != rt.Size() {
+		return nil, reflect.Value{}, fmt.Errorf("%w: %s is %d bytes, rebuilt as %d", ErrUnsupportedType, typ.String(), typ.Size(), rt.Size())
+	}
+	return typ, reflect.NewAt(rt, *(*unsafe.Pointer)(unsafe.Pointer(&addr))).Elem(), nil
+}
+
+// Var reads the current value of a package-level variable such as
+// `main.maxRetries`, rendered by f, or by the default formatter if f is nil.
+func (r *Runtime) Var(name string, f *Formatter) (*Variable, error) {
+	typ, v, err := r.varValue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == nil {
+		f = NewFormatter()
+	}
+	value, err := f.Value(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Variable{Name: name, Type: typ.String(), Address: uint64(v.UnsafeAddr()), Value: value}, nil
+}
+
+// hasPointers reports whether a value holds a reference other than a string,
+// which would dangle once written into a variable the collector does not
+// expect to change.
+func hasPointers(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer:
+		return !v.IsNil()
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if hasPointers(v.Field(i)) {
+				return true
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if hasPointers(v.Index(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (*patcher) SetVar(r *Runtime, m Request) (*Guard, error) {
+	var point VarPoint
+	if err := mapstructure.Decode(m, &point); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportAction, err)
+	}
+
+	t, err := point.trigger()
+	if err != nil {
+		return nil, err
+	}
+	if t.perCall() || t.probability < 1 {
+		return nil, fmt.Errorf("%w: a variable is set once, not call by call", ErrUnsupportAction)
+	}
+	typ, target, err := r.varValue(point.Func)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := Decode(target.Type(), point.Val)
+	if err != nil {
+		return nil, err
+	}
+	if hasPointers(v) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeValue, typ.String())
+	}
+	// Count the one set, so that it shows as fired among the points.
+	t.Fire()
+	guard := PatchValue(target, v)
+	guard.trigger = t
+	return guard, nil
+}
@@ -0,0 +1,156 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type test_var_config struct {
+	Name    string
+	Retries int
+	Tags    []string
+	Limits  map[string]int
+}
+
+var (
+	test_var_retries = 3
+	test_var_timeout = time.Second
+	test_var_conf    = &test_var_config{
+		Name:    "doom",
+		Retries: 5,
+		Tags:    []string{"a", "b", "c"},
+		Limits:  map[string]int{"x": 1},
+	}
+)
+
+var _ = Describe("Test Package Variables", func() {
+	var (
+		r *Runtime
+	)
+
+	BeforeEach(func() {
+		test_var_retries++
+		test_var_timeout++
+		test_var_conf.Retries++
+		r, _ = New(pid)
+	})
+
+	It("should read a basic variable", func() {
+		v, err := r.Var("github.com/u2386/go-hijack/runtime.test_var_retries", nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Type).To(Equal("int"))
+		Expect(v.Address).ShouldNot(BeZero())
+		Expect(v.Value).To(BeEquivalentTo(test_var_retries))
+	})
+
+	It("should read a struct through a pointer", func() {
+		f := NewFormatter()
+		f.Length, f.Maps = 2, true
+		v, err := r.Var("github.com/u2386/go-hijack/runtime.test_var_conf", f)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		m, ok := v.Value.(map[string]interface{})
+		Expect(ok).Should(BeTrue())
+		Expect(m["Name"]).To(Equal("do" + truncated))
+		Expect(m["Retries"]).To(BeEquivalentTo(test_var_conf.Retries))
+		Expect(m["Tags"]).To(Equal([]interface{}{"a", "b", truncated}))
+		Expect(m["Limits"]).To(Equal(map[string]interface{}{"x": int64(1)}))
+
+		v, err = r.Var("github.com/u2386/go-hijack/runtime.test_var_conf", nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Value.(map[string]interface{})["Limits"]).To(HavePrefix("map[string]int(len=1, 0x"))
+	})
+
+	It("should limit depth", func() {
+		f := NewFormatter()
+		f.Depth = 1
+		v, err := r.Var("github.com/u2386/go-hijack/runtime.test_var_conf", f)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(v.Value).To(Equal(truncated))
+	})
+
+	It("should return error", func() {
+		_, err := r.Var("unknown", nil)
+		Expect(err).Should(MatchError(ErrVarNotFound))
+	})
+
+	It("should render values", func() {
+		out, err := Render(reflect.ValueOf(strings.Repeat("x", 10)), DefaultDepth, 4)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(out).To(Equal("xxxx" + truncated))
+
+		out, err = Render(reflect.ValueOf((*int)(nil)), DefaultDepth, DefaultLength)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(out).To(BeNil())
+	})
+
+	It("should set and restore a variable", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Run(ctx)
+
+		old := test_var_retries
+		err := r.Hijack(map[string]interface{}{
+			"func":   "github.com/u2386/go-hijack/runtime.test_var_retries",
+			"action": "setvar",
+			"val":    float64(0),
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(test_var_retries).To(BeZero())
+
+		r.Release("github.com/u2386/go-hijack/runtime.test_var_retries")
+		Expect(test_var_retries).To(Equal(old))
+	})
+
+	It("should set a duration", func() {
+		old := test_var_timeout
+		g, err := (&patcher{}).SetVar(r, map[string]interface{}{
+			"func":   "github.com/u2386/go-hijack/runtime.test_var_timeout",
+			"action": "setvar",
+			"val":    "1ms",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(test_var_timeout).To(Equal(time.Millisecond))
+
+		g.Unpatch()
+		Expect(test_var_timeout).To(Equal(old))
+	})
+
+	It("should reject mismatched values", func() {
+		_, err := (&patcher{}).SetVar(r, map[string]interface{}{
+			"func": "github.com/u2386/go-hijack/runtime.test_var_retries",
+			"val":  "zero",
+		})
+		Expect(err).Should(MatchError(ErrDecode))
+
+		_, err = (&patcher{}).SetVar(r, map[string]interface{}{
+			"func": "github.com/u2386/go-hijack/runtime.test_var_retries",
+			"val":  1.5,
+		})
+		Expect(err).Should(MatchError(ErrDecode))
+	})
+
+	It("should only write nil pointers", func() {
+		_, err := (&patcher{}).SetVar(r, map[string]interface{}{
+			"func": "github.com/u2386/go-hijack/runtime.test_var_conf",
+			"val":  map[string]interface{}{"Name": "x"},
+		})
+		Expect(err).Should(HaveOccurred())
+
+		conf := test_var_conf
+		g, err := (&patcher{}).SetVar(r, map[string]interface{}{
+			"func": "github.com/u2386/go-hijack/runtime.test_var_conf",
+			"val":  nil,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(test_var_conf).To(BeNil())
+
+		g.Unpatch()
+		Expect(test_var_conf).To(Equal(conf))
+	})
+})
@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+// variadicDecl reports whether the function declared at file:line takes a
+// variadic last parameter. DWARF of a function cannot tell `...T` from `[]T`,
+// so the declaration is read from source when it is at hand.
+func variadicDecl(file string, line int) bool {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, 0)
+	if err != nil {
+		return false
+	}
+
+	var found []*ast.FuncType
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			if fset.Position(fn.Pos()).Line == line {
+				found = append(found, fn.Type)
+			}
+		case *ast.FuncLit:
+			if fset.Position(fn.Pos()).Line == line {
+				found = append(found, fn.Type)
+			}
+		}
+		return true
+	})
+	// Several functions declared on one line are ambiguous.
+	if len(found) != 1 || found[0].Params == nil || len(found[0].Params.List) == 0 {
+		return false
+	}
+	params := found[0].Params.List
+	_, ok := params[len(params)-1].Type.(*ast.Ellipsis)
+	return ok
+}
+
+func variadicOf(typ reflect.Type) reflect.Type {
+	var in, out []reflect.Type
+	for i := 0; i < typ.NumIn(); i++ {
+		in = append(in, typ.In(i))
+	}
+	for i := 0; i < typ.NumOut(); i++ {
+		out = append(out, typ.Out(i))
+	}
+	return reflect.FuncOf(in, out, true)
+}
+
+// asVariadic returns the variadic variant of typ, for a caller that knows the
+// last parameter is declared with `...` when the source is not at hand.
+func asVariadic(typ reflect.Type) (reflect.Type, error) {
+	if typ.IsVariadic() {
+		return typ, nil
+	}
+	if n := typ.NumIn(); n == 0 || typ.In(n-1).Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%w: the last parameter of %s is not a slice", ErrUnsupportAction, typ)
+	}
+	return variadicOf(typ), nil
+}
+
+// makeFunc is MakeFunc, producing a variadic type when the source declares
+// the last parameter with `...`.
+func (r *Runtime) makeFunc(node *godwarf.Tree) (reflect.Type, error) {
+	typ, err := r.types.Func(node)
+	if err != nil {
+		return nil, err
+	}
+	if n := typ.NumIn(); n == 0 || typ.In(n-1).Kind() != reflect.Slice {
+		return typ, nil
+	}
+
+	line, _ := node.Entry.Val(dwarf.AttrDeclLine).(int64)
+	if line == 0 || !variadicDecl(r.declFile(node.Offset), int(line)) {
+		return typ, nil
+	}
+	return variadicOf(typ), nil
+}
+
+// call calls fn with args as received by a reflect.MakeFunc function, whose
+// variadic arguments come as one slice.
+func call(fn reflect.Value, args []reflect.Value) []reflect.Value {
+	if fn.Type().IsVariadic() {
+		return fn.CallSlice(args)
+	}
+	return fn.Call(args)
+}
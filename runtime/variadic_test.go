@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"debug/elf"
+	"fmt"
+	"reflect"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:noinline
+func test_for_variadic(prefix string, args ...string) string {
+	return prefix + ":" + strings.Join(args, ",")
+}
+
+//go:noinline
+func test_for_slice(prefix string, args []int) string {
+	return fmt.Sprint(prefix, args)
+}
+
+//go:noinline
+func test_for_direct_variadic(kv ...int64) int { return len(kv) }
+
+//go:noinline
+func test_for_variadic_callback(f func(string, ...int) int) int { return f("", 1) }
+
+// test_variadic_value has the type test_for_slice would have were it variadic.
+var test_variadic_value = func(prefix string, args ...int) string { return prefix }
+
+var (
+	_ = test_for_variadic("")
+	_ = test_for_slice("", nil)
+	_ = test_for_direct_variadic(1)
+	_ = test_for_variadic_callback(func(string, ...int) int { return 0 })
+	_ = test_variadic_value("")
+)
+
+var _ = Describe("Test Variadic Functions", func() {
+	const name = "github.com/u2386/go-hijack/runtime.test_for_variadic"
+
+	var (
+		r *Runtime
+		g *Guard
+	)
+
+	BeforeEach(func() {
+		r, _ = New(pid)
+		g = nil
+	})
+
+	AfterEach(func() {
+		if g != nil {
+			g.Unpatch()
+		}
+	})
+
+	It("should tell variadic parameters from slices", func() {
+		ft, err := r.makeFunc(r.dwarftrees["github.com/u2386/go-hijack/runtime.test_for_slice"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.IsVariadic()).Should(BeFalse())
+		Expect(reflect.TypeOf(test_variadic_value).String()).To(Equal("func(string, ...int) string"))
+
+		// Never used as a value, so the binary has no runtime type for it.
+		ft, err = r.makeFunc(r.dwarftrees["github.com/u2386/go-hijack/runtime.test_for_direct_variadic"])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.String()).To(Equal("func(...int64) int"))
+	})
+
+	It("should make variadic types", func() {
+		ft, err := r.makeFunc(r.dwarftrees[name])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft.String()).To(Equal("func(string, ...string) string"))
+
+		sig, err := r.Signature(name)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sig.Variadic).To(BeTrue())
+	})
+
+	It("should make variadic function types without runtime types", func() {
+		ef, _ := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+		dw, _ := ef.DWARF()
+		trees, _ := DwarfTree(dw)
+		ft, err := MakeFunc(trees["github.com/u2386/go-hijack/runtime.test_for_variadic_callback"], dw)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ft).To(Equal(reflect.TypeOf(test_for_variadic_callback)))
+	})
+
+	It("should set the whole variadic slice", func() {
+		var err error
+		g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 1, "val": []interface{}{"a", "b"}})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(test_for_variadic("p", "x")).To(Equal("p:a,b"))
+	})
+
+	It("should set a single variadic element", func() {
+		var err error
+		g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 1, "elem": 1, "val": "z"})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		args := []string{"x", "y"}
+		Expect(test_for_variadic("p", args...)).To(Equal("p:x,z"))
+		Expect(args[1]).To(Equal("y"))
+		Expect(test_for_variadic("p", "x")).To(Equal("p:x"))
+	})
+
+	It("should take the variadic flag where the source cannot tell", func() {
+		const name = "github.com/u2386/go-hijack/runtime.test_for_slice"
+		_, err := (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 1, "elem": 0, "val": 7})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+
+		g, err = (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 1, "elem": 0, "val": 7, "variadic": true})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(test_for_slice("p", []int{1, 2})).To(Equal("p[7 2]"))
+
+		_, err = (&patcher{}).Set(r, map[string]interface{}{
+			"func": "github.com/u2386/go-hijack/runtime.test_for_unnamed", "index": 0, "val": 1, "variadic": true,
+		})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+	})
+
+	It("should refuse elements of other arguments", func() {
+		_, err := (&patcher{}).Set(r, map[string]interface{}{"func": name, "index": 0, "elem": 0, "val": "z"})
+		Expect(err).Should(MatchError(ErrUnsupportAction))
+	})
+})
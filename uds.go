@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/u2386/go-hijack/runtime"
 	"golang.org/x/sync/errgroup"
 )
@@ -74,8 +76,7 @@ func (s *uds) serve(conn net.Conn) {
 
 	v := strings.SplitN(line, " ", 2)
 	if len(v) != 2 {
-		io.Copy(conn, bytes.NewReader([]byte(fmt.Sprint("unknown:", line))))
-		return
+		v = append(v, "")
 	}
 
 	switch comm, args := strings.TrimSpace(v[0]), strings.TrimSpace(v[1]); comm {
@@ -83,13 +84,42 @@ func (s *uds) serve(conn net.Conn) {
 		io.Copy(conn, bytes.NewReader([]byte(args)))
 
 	case "/get":
+		var query string
+		if v := strings.SplitN(args, " ", 2); len(v) == 2 {
+			args, query = v[0], strings.TrimSpace(v[1])
+		}
+
 		switch args {
 		case "funcs":
-			ns := s.Runtime.Funcs()
-			io.Copy(conn, strings.NewReader(fmt.Sprint("funcs:", strings.Join(ns, "\n"))))
+			if query == "" {
+				ns := s.Runtime.Funcs()
+				io.Copy(conn, strings.NewReader(fmt.Sprint("funcs:", strings.Join(ns, "\n"))))
+				return
+			}
+			s.catalog(conn, query)
+		case "signature":
+			sig, err := s.Runtime.Signature(query)
+			reply(conn, "signature:", sig, err)
+		case "location":
+			loc, err := s.Runtime.Locate(query)
+			reply(conn, "location:", loc, err)
+		case "lookup":
+			locs, err := s.Runtime.Lookup(query)
+			reply(conn, "lookup:", locs, err)
+		case "source":
+			src, err := s.Runtime.Source(query, runtime.SourceContext)
+			reply(conn, "source:", src, err)
+		case "code":
+			c, err := s.Runtime.Code(query)
+			reply(conn, "code:", c, err)
+		case "toolchain":
+			reply(conn, "toolchain:", s.Runtime.Toolchain(), nil)
+		case "types":
+			reply(conn, "types:", s.Runtime.TypeStats(), nil)
+		case "var":
+			s.variable(conn, query)
 		case "points":
-			ns := s.Runtime.Points()
-			io.Copy(conn, strings.NewReader(fmt.Sprint("points:", strings.Join(ns, "\n"))))
+			reply(conn, "points:", s.Runtime.PointStats(), nil)
 		}
 
 	case "/post":
@@ -104,6 +134,9 @@ func (s *uds) serve(conn net.Conn) {
 		}
 		io.Copy(conn, strings.NewReader("ok"))
 
+	case "/selftest":
+		reply(conn, "selftest:", s.Runtime.SelfTest(args), nil)
+
 	case "/delete":
 		s.Runtime.Release(args)
 		io.Copy(conn, strings.NewReader("ok"))
@@ -112,3 +145,61 @@ func (s *uds) serve(conn net.Conn) {
 		io.Copy(conn, strings.NewReader(fmt.Sprint("unknown:", line)))
 	}
 }
+
+func (s *uds) catalog(conn net.Conn, query string) {
+	m := s.Parser.Parse(query)
+	if m == nil {
+		io.Copy(conn, strings.NewReader("error: parse error"))
+		return
+	}
+
+	var q runtime.FuncQuery
+	if err := mapstructure.Decode(m, &q); err != nil {
+		io.Copy(conn, strings.NewReader(fmt.Sprintf("error:%s", err)))
+		return
+	}
+
+	c, err := s.Runtime.Catalog(q)
+	reply(conn, "funcs:", c, err)
+}
+
+func (s *uds) variable(conn net.Conn, query string) {
+	opts := struct {
+		Depth  int
+		Length int
+		Maps   bool
+	}{runtime.DefaultDepth, runtime.DefaultLength, false}
+
+	name := query
+	if v := strings.SplitN(query, " ", 2); len(v) == 2 {
+		m := s.Parser.Parse(v[1])
+		if m == nil {
+			io.Copy(conn, strings.NewReader("error: parse error"))
+			return
+		}
+		if err := mapstructure.Decode(m, &opts); err != nil {
+			io.Copy(conn, strings.NewReader(fmt.Sprintf("error:%s", err)))
+			return
+		}
+		name = v[0]
+	}
+
+	f := runtime.NewFormatter()
+	f.Depth, f.Length, f.Maps = opts.Depth, opts.Length, opts.Maps
+	v, err := s.Runtime.Var(name, f)
+	reply(conn, "var:", v, err)
+}
+
+func reply(conn net.Conn, prefix string, v interface{}, err error) {
+	if err != nil {
+		io.Copy(conn, strings.NewReader(fmt.Sprintf("error:%s", err)))
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		io.Copy(conn, strings.NewReader(fmt.Sprintf("error:%s", err)))
+		return
+	}
+	io.Copy(conn, bytes.NewReader(append([]byte(prefix), b...)))
+}